@@ -10,6 +10,7 @@ import (
 
 	"github.com/alonsoF100/reporting-service/internal/config"
 	"github.com/alonsoF100/reporting-service/internal/logger"
+	"github.com/alonsoF100/reporting-service/internal/report"
 	"github.com/alonsoF100/reporting-service/internal/repository/postgres"
 	"github.com/alonsoF100/reporting-service/internal/service"
 	"github.com/alonsoF100/reporting-service/internal/transport/handler"
@@ -39,9 +40,15 @@ func main() {
 	repo := postgres.New(pool)
 	slog.Info("database connected")
 
-	deviceService := service.NewDeviceService(repo)
+	deviceService := service.NewDeviceService(repo, cfg.Application.Fonts)
 
-	scanner := service.NewScanner(cfg, repo)
+	renderers, err := report.NewRenderers(cfg.Application.Reports, cfg.Application.Fonts)
+	if err != nil {
+		slog.Error("failed to configure report formats", "error", err)
+		os.Exit(1)
+	}
+
+	scanner := service.NewScanner(cfg, repo, renderers)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -51,7 +58,9 @@ func main() {
 		"interval", cfg.Application.Period,
 		"workers", cfg.Application.Workers)
 
-	h := handler.New(deviceService)
+	fileService := service.NewFileService(repo, scanner, cfg.Application.Input)
+
+	h := handler.New(deviceService, fileService, cfg.Application.UploadMaxSize)
 	srv := server.New(cfg, h, log)
 
 	go func() {
@@ -8,6 +8,8 @@ type Config struct {
 	Logger      LoggerConfig      `mapstructure:"logger"`
 	Migration   MigrationsConfig  `mapstructure:"migrations"`
 	Application ApplicationConfig `mapstructure:"application"`
+	Parser      ParserConfig      `mapstructure:"parser"`
+	Retry       RetryConfig       `mapstructure:"retry"`
 }
 
 type DatabaseConfig struct {
@@ -38,8 +40,44 @@ type MigrationsConfig struct {
 type ApplicationConfig struct {
 	Input      string        `mapstructure:"input_dir"`
 	Output     string        `mapstructure:"output_dir"`
+	Archive    string        `mapstructure:"archive_dir"`
+	Quarantine string        `mapstructure:"quarantine_dir"`
+	Fonts      string        `mapstructure:"fonts_dir"`
+	Reports    []string      `mapstructure:"report_formats"`
 	Period     time.Duration `mapstructure:"scan_period"`
-	QueueSize  int           `mapstructure:"queue_size"`
+	Watch      bool          `mapstructure:"watch"`
+	WatchDelay time.Duration `mapstructure:"watch_delay"`
 	Workers    int           `mapstructure:"workers"`
-	MaxRetries int           `mapstructure:"max_retries"`
+
+	StabilityWindow time.Duration `mapstructure:"stability_window"`
+	ReadyMarkers    bool          `mapstructure:"ready_markers"`
+	ArchiveGzip     bool          `mapstructure:"archive_gzip"`
+	BatchSize       int           `mapstructure:"batch_size"`
+	UploadMaxSize   int64         `mapstructure:"upload_max_size"` // байт, для POST /api/v1/files
+	LeaseDuration   time.Duration `mapstructure:"lease_duration"`  // сколько файл в processing и задание в jobs живут без heartbeat воркера
+	PollInterval    time.Duration `mapstructure:"poll_interval"`   // как часто свободный воркер проверяет очередь jobs
+}
+
+// RetryConfig - повторные попытки обработки файла: пауза перед попыткой n равна base * 2^(n-1),
+// но не больше max, плюс случайная добавка до jitter от паузы
+type RetryConfig struct {
+	Base        time.Duration `mapstructure:"base"`
+	Max         time.Duration `mapstructure:"max"`
+	Jitter      float64       `mapstructure:"jitter"`       // доля паузы, 0.2 - до +20%
+	MaxAttempts int           `mapstructure:"max_attempts"` // всего попыток с учетом прошлых сканов, потом статус failed
+}
+
+type ParserConfig struct {
+	Strict         bool           `mapstructure:"strict"`          // невалидная строка отменяет загрузку всего файла
+	MessageClasses []string       `mapstructure:"message_classes"` // допустимые классы, по умолчанию из парсера
+	Encoding       string         `mapstructure:"encoding"`        // кодировка файлов без BOM, auto - определить
+	Sources        []SourceConfig `mapstructure:"sources"`
+}
+
+// SourceConfig - профиль источника данных: к каким файлам относится и как называются колонки
+type SourceConfig struct {
+	Name     string              `mapstructure:"name"`
+	Match    string              `mapstructure:"match"`    // glob по имени файла, например "plant2_*"
+	Encoding string              `mapstructure:"encoding"` // перекрывает parser.encoding
+	Columns  map[string][]string `mapstructure:"columns"`  // колонка DeviceMessage -> имена в заголовке
 }
@@ -1,6 +1,13 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/parser"
+)
 
 func (cfg ServerConfig) PortStr() string {
 	return fmt.Sprintf(":%d", cfg.Port)
@@ -17,3 +24,55 @@ func (cfg *DatabaseConfig) ConStr() string {
 		cfg.SSLMode,
 	)
 }
+
+// Validate - проверяет кодировки parser.encoding и профилей источников
+func (cfg ParserConfig) Validate() error {
+	if err := parser.CheckEncoding(cfg.Encoding); err != nil {
+		return fmt.Errorf("parser.encoding: %w", err)
+	}
+	for _, src := range cfg.Sources {
+		if err := parser.CheckEncoding(src.Encoding); err != nil {
+			return fmt.Errorf("parser.sources[%s].encoding: %w", src.Name, err)
+		}
+	}
+	return nil
+}
+
+// Source - профиль первого источника, под который подходит имя файла.
+// Если ни один не подошел, возвращается пустой профиль со стандартными колонками.
+// Кодировка, не заданная в профиле, берется из parser.encoding
+func (cfg ParserConfig) Source(fileName string) SourceConfig {
+	src := SourceConfig{Name: "default"}
+	for _, candidate := range cfg.Sources {
+		if ok, _ := filepath.Match(candidate.Match, fileName); ok {
+			src = candidate
+			break
+		}
+	}
+
+	if src.Encoding == "" {
+		src.Encoding = cfg.Encoding
+	}
+	return src
+}
+
+// Delay - пауза перед следующей попыткой после неудачной попытки attempt (считая с 1)
+func (cfg RetryConfig) Delay(attempt int) time.Duration {
+	delay := cfg.Base
+	for i := 1; i < attempt && (cfg.Max <= 0 || delay < cfg.Max); i++ {
+		delay *= 2
+	}
+	if cfg.Max > 0 && delay > cfg.Max {
+		delay = cfg.Max
+	}
+
+	if cfg.Jitter > 0 && delay > 0 {
+		delay += time.Duration(rand.Float64() * cfg.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// Exhausted - исчерпаны ли попытки: без max_attempts файл пробуется один раз
+func (cfg RetryConfig) Exhausted(attempt int) bool {
+	return attempt >= max(cfg.MaxAttempts, 1)
+}
@@ -9,15 +9,47 @@ import (
 func Load() *Config {
 	viper.SetConfigFile("config.yaml")
 
+	// без явного списка форматов генерируем только PDF, как раньше
+	viper.SetDefault("application.report_formats", []string{"pdf"})
+	viper.SetDefault("application.watch_delay", "1s")
+	viper.SetDefault("application.batch_size", 5000)
+	viper.SetDefault("application.upload_max_size", 100<<20)
+	viper.SetDefault("application.lease_duration", "1m")
+	viper.SetDefault("application.poll_interval", "1s")
+	viper.SetDefault("retry.base", "2s")
+	viper.SetDefault("retry.max", "5m")
+	viper.SetDefault("retry.jitter", 0.2)
+
 	if err := viper.ReadInConfig(); err != nil {
 		log.Fatal("Failed to read config file err:", err)
 	}
 
+	// application.max_retries из старых конфигов - то же число попыток, что retry.max_attempts.
+	// Умолчание для max_attempts ставится после проверки, иначе IsSet всегда бы видел его
+	if viper.IsSet("application.max_retries") {
+		if viper.IsSet("retry.max_attempts") {
+			log.Println("Config warning: application.max_retries is deprecated and ignored, retry.max_attempts is set")
+		} else {
+			log.Println("Config warning: application.max_retries is deprecated, use retry.max_attempts")
+			viper.Set("retry.max_attempts", viper.GetInt("application.max_retries"))
+		}
+	}
+	viper.SetDefault("retry.max_attempts", 3)
+
+	// очередь теперь - таблица jobs в БД, размер канала из старых конфигов ни на что не влияет
+	if viper.IsSet("application.queue_size") {
+		log.Println("Config warning: application.queue_size is no longer used and is ignored, files are queued in the jobs table")
+	}
+
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		log.Fatal("Failed to decode config err:", err)
 	}
 
+	if err := config.Parser.Validate(); err != nil {
+		log.Fatal("Invalid config err:", err)
+	}
+
 	log.Println("Config loaded successfully")
 	return &config
 }
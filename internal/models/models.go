@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"io"
+	"time"
+)
 
 // TODO добавить модели данных
 type DeviceMessage struct {
@@ -15,24 +19,153 @@ type DeviceMessage struct {
 	Level        int    `json:"level"`         // уровень сообщения [int]
 	Area         string `json:"area"`          // зона переменных HR,IR.I,C
 	Address      string `json:"address"`       // адрес переменной в контроллере
+
+	SourceFile string    `json:"source_file"` // файл, из которого загружено сообщение
+	SourceRow  int       `json:"source_row"`  // номер строки в этом файле
+	CreatedAt  time.Time `json:"created_at"`  // время первой загрузки файла в БД
+}
+
+// NextBatch - отдает следующую пачку сообщений, io.EOF когда сообщения закончились
+type NextBatch func() ([]DeviceMessage, error)
+
+// BatchOf - NextBatch, отдающий уже прочитанные сообщения одной пачкой
+func BatchOf(messages []DeviceMessage) NextBatch {
+	done := false
+	return func() ([]DeviceMessage, error) {
+		if done || len(messages) == 0 {
+			return nil, io.EOF
+		}
+		done = true
+		return messages, nil
+	}
 }
 
 type ParseResult struct {
 	FileName string          `json:"file_name"`
 	Messages []DeviceMessage `json:"messages"`
+	Rejected []RejectedRow   `json:"rejected"`
+}
+
+// RejectedRow - строка файла, не прошедшая проверку и не загруженная в БД
+type RejectedRow struct {
+	FileName  string    `json:"file_name" db:"file_name"`
+	Row       int       `json:"row" db:"row_number"`  // номер строки в файле
+	Reason    string    `json:"reason" db:"reason"`   // почему строка отклонена
+	Content   string    `json:"content" db:"content"` // строка как есть
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 type ProcessedFile struct {
 	ID           int64     `json:"id" db:"id"`
 	FileName     string    `json:"file_name" db:"file_name"`
-	Status       string    `json:"status" db:"status"` // processing, processed, error
+	Status       string    `json:"status" db:"status"` // queued, processing, processed, error, failed, duplicate
 	ErrorMessage string    `json:"error_message" db:"error_message"`
+	ContentHash  string    `json:"content_hash" db:"content_hash"` // SHA-256 содержимого
+	Revision     int       `json:"revision" db:"revision"`         // растет, когда под тем же именем приходит другое содержимое
+	DuplicateOf  string    `json:"duplicate_of" db:"duplicate_of"` // файл с тем же содержимым, загруженный раньше
+	ArchivePath  string    `json:"archive_path" db:"archive_path"` // zip, из которого извлечен файл
+	Attempts     int       `json:"attempts" db:"attempts"`         // сколько раз воркер брался за файл
 	ProcessedAt  time.Time `json:"processed_at" db:"processed_at"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+
+	// аренда файла воркером, пока он в processing: без heartbeat файл вернется в очередь
+	WorkerID       string     `json:"worker_id,omitempty" db:"worker_id"`
+	HeartbeatAt    *time.Time `json:"heartbeat_at,omitempty" db:"heartbeat_at"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty" db:"lease_expires_at"`
+
+	// когда файл со статусом error можно пробовать снова (растет с каждой попыткой)
+	// и почему упала последняя попытка: permanent - дело в самом файле, transient - сбой БД или диска
+	NextRetryAt   *time.Time `json:"next_retry_at,omitempty" db:"next_retry_at"`
+	ErrorCategory string     `json:"error_category,omitempty" db:"error_category"`
+
+	// сколько строк отклонено при загрузке, в rejected_rows сохраняются только первые из них
+	RejectedCount int `json:"rejected_count" db:"rejected_count"`
+}
+
+// Claimable - можно ли забрать файл в работу: он ждет обработки, у упавшего с ошибкой подошло
+// время повтора, аренда прошлого воркера истекла, или под тем же именем пришло другое содержимое (новая ревизия)
+func (f ProcessedFile) Claimable(contentHash string, now time.Time, lease time.Duration) bool {
+	switch f.Status {
+	case StatusProcessing:
+		if f.LeaseExpiresAt != nil {
+			return f.LeaseExpiresAt.Before(now)
+		}
+		// запись без аренды: файл из zip или упавший до первой попытки
+		return f.ArchivePath == "" && f.ProcessedAt.Before(now.Add(-lease))
+	case StatusError:
+		return f.NextRetryAt == nil || !f.NextRetryAt.After(now)
+	case StatusProcessed, StatusDuplicate, StatusFailed:
+		// для старых записей без хеша считаем, что содержимое не менялось
+		return f.ContentHash != "" && f.ContentHash != contentHash
+	default:
+		return true
+	}
+}
+
+// FileDetails - файл со сводкой по тому, что из него загружено
+type FileDetails struct {
+	ProcessedFile
+	Messages int      `json:"messages"` // сколько сообщений файла лежит в БД
+	Devices  []string `json:"devices"`  // unit_guid устройств, чьи сообщения были в файле
+	Rejected int      `json:"rejected"` // сколько строк отклонено при загрузке
 }
 
 const (
+	StatusQueued     = "queued" // загружен через API и ждет воркера
 	StatusProcessing = "processing"
 	StatusProcessed  = "processed"
-	StatusError      = "error"
+	StatusError      = "error"  // попытка упала, файл будет повторен после next_retry_at
+	StatusFailed     = "failed" // попытки исчерпаны, автоматически файл больше не берется
+	StatusDuplicate  = "duplicate"
+)
+
+const (
+	ErrorPermanent = "permanent" // файл битый или не прошел проверку, повторять нет смысла
+	ErrorTransient = "transient" // сбой БД или ввода-вывода, попытку стоит повторить
+)
+
+// Job - задание на обработку файла из input в очереди jobs
+type Job struct {
+	ID          int64      `json:"id" db:"id"`
+	FileName    string     `json:"file_name" db:"file_name"`
+	Priority    int        `json:"priority" db:"priority"` // больше - раньше
+	Force       bool       `json:"force" db:"force"`       // загрузить заново, даже если содержимое уже есть в БД
+	Attempts    int        `json:"attempts" db:"attempts"` // сколько раз задание выдавалось воркерам
+	NextRunAt   time.Time  `json:"next_run_at" db:"next_run_at"`
+	LockedBy    string     `json:"locked_by,omitempty" db:"locked_by"`
+	LockedUntil *time.Time `json:"locked_until,omitempty" db:"locked_until"` // до этого задание не видно другим воркерам
+	LastError   string     `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+const (
+	PriorityNormal = 0  // файлы, найденные сканером и вотчером
+	PriorityHigh   = 10 // загрузки и перезагрузки через API
+)
+
+// MessageFilter - фильтр сообщений устройства, пустые поля не ограничивают выборку
+type MessageFilter struct {
+	From       time.Time // created_at >= From, created_at - время первой загрузки файла
+	To         time.Time // created_at < To
+	Classes    []string  // message_class IN (...)
+	SourceFile string    // source_file = SourceFile
+}
+
+// Report - готовый отчет по устройству для отдачи клиенту
+type Report struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+var (
+	ErrUnknownFormat   = errors.New("unknown report format")
+	ErrNoMessages      = errors.New("device not found or no messages")
+	ErrFileNotFound    = errors.New("file not found")
+	ErrFileExists      = errors.New("file with this name is already waiting in input")
+	ErrUnsupportedFile = errors.New("unsupported file type")
+	ErrFileBusy        = errors.New("file is already queued or being processed")
+	ErrFileGone        = errors.New("file is no longer in input, archive or quarantine")
+	ErrUnknownStatus   = errors.New("unknown file status")
+	ErrLeaseLost       = errors.New("file lease is no longer held by this worker")
 )
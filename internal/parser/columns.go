@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Колонки DeviceMessage, на которые отображаются колонки файла
+const (
+	ColumnNumber       = "number"
+	ColumnMqtt         = "mqtt"
+	ColumnInvid        = "invid"
+	ColumnUnitGUID     = "unit_guid"
+	ColumnMessageID    = "message_id"
+	ColumnMessageText  = "message_text"
+	ColumnContext      = "context"
+	ColumnMessageClass = "message_class"
+	ColumnLevel        = "level"
+	ColumnArea         = "area"
+	ColumnAddress      = "address"
+)
+
+// ErrMissingColumn - в заголовке файла нет обязательной колонки
+var ErrMissingColumn = errors.New("required column not found in header")
+
+// Columns - имена колонок в заголовке файла (алиасы) для каждой колонки DeviceMessage
+type Columns map[string][]string
+
+// DefaultColumns - имена из машинного заголовка (вторая строка) выгрузок контроллеров
+var DefaultColumns = Columns{
+	ColumnNumber:       {"n", "number"},
+	ColumnMqtt:         {"mqtt"},
+	ColumnInvid:        {"invid"},
+	ColumnUnitGUID:     {"unit_guid"},
+	ColumnMessageID:    {"msg_id", "message_id"},
+	ColumnMessageText:  {"text", "message_text"},
+	ColumnContext:      {"context"},
+	ColumnMessageClass: {"class", "message_class"},
+	ColumnLevel:        {"level"},
+	ColumnArea:         {"area"},
+	ColumnAddress:      {"addr", "address"},
+}
+
+// без этих колонок сообщение не к чему привязать
+var requiredColumns = []string{ColumnUnitGUID, ColumnMessageID}
+
+// Options - настройки чтения файлов конкретного источника
+type Options struct {
+	// дополнительные алиасы к DefaultColumns, например для новой прошивки
+	Columns Columns
+
+	// Strict - первая же невалидная строка отменяет загрузку файла,
+	// иначе такие строки пропускаются и попадают в Rejected
+	Strict bool
+
+	// допустимые классы сообщений, по умолчанию DefaultMessageClasses
+	Classes []string
+
+	// кодировка файла без BOM (windows-1251, koi8-r, utf-16le, ...), пусто или auto - определить
+	Encoding string
+}
+
+// columnIndex - номер колонки в файле для каждой колонки DeviceMessage
+type columnIndex map[string]int
+
+// mapHeader - сопоставляет колонки заголовка с колонками DeviceMessage по именам.
+// Порядок колонок не важен, лишние и неизвестные колонки возвращаются отдельно и игнорируются
+func mapHeader(header []string, extra Columns) (columnIndex, []string, error) {
+	lookup := make(map[string]string)
+	for _, aliases := range []Columns{DefaultColumns, extra} {
+		for column, names := range aliases {
+			for _, name := range names {
+				lookup[normalizeHeader(name)] = column
+			}
+		}
+	}
+
+	index := make(columnIndex)
+	var unknown []string
+
+	for i, name := range header {
+		name = normalizeHeader(name)
+		if name == "" {
+			continue
+		}
+
+		column, ok := lookup[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+
+		// если колонка повторяется, берем первую
+		if _, exists := index[column]; !exists {
+			index[column] = i
+		}
+	}
+
+	for _, column := range requiredColumns {
+		if _, ok := index[column]; !ok {
+			return nil, nil, fmt.Errorf("%w: %s", ErrMissingColumn, column)
+		}
+	}
+
+	return index, unknown, nil
+}
+
+// value - значение колонки в строке, пусто если колонки нет в файле или строка короче заголовка
+func (idx columnIndex) value(record []string, column string) string {
+	i, ok := idx[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func normalizeHeader(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
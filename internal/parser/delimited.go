@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+)
+
+// csvReader - TSV/CSV через encoding/csv
+type csvReader struct {
+	reader *csv.Reader
+	line   int
+}
+
+func delimitedRows(comma rune) func(r io.Reader) (RowReader, error) {
+	return func(r io.Reader) (RowReader, error) {
+		return newCSVRows(r, comma), nil
+	}
+}
+
+// sniffedDelimitedRows - CSV с запятой или точкой с запятой: разделитель определяется по первой строке
+func sniffedDelimitedRows(r io.Reader) (RowReader, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	return newCSVRows(br, sniffDelimiter(firstLine(head))), nil
+}
+
+// sniffDelimiter - самый частый из разделителей в строке
+func sniffDelimiter(line []byte) rune {
+	best, bestCount := ',', 0
+	for _, comma := range []rune{'\t', ';', ','} {
+		if n := bytes.Count(line, []byte(string(comma))); n > bestCount {
+			best, bestCount = comma, n
+		}
+	}
+	return best
+}
+
+func newCSVRows(r io.Reader, comma rune) *csvReader {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1 // число колонок задает заголовок, строки могут быть короче
+	reader.ReuseRecord = true
+
+	return &csvReader{reader: reader}
+}
+
+func (c *csvReader) Read() ([]string, error) {
+	record, err := c.reader.Read()
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		c.line = parseErr.StartLine
+		return nil, &RowError{Line: parseErr.StartLine, Err: parseErr.Err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.line, _ = c.reader.FieldPos(0)
+	return record, nil
+}
+
+func (c *csvReader) Line() int {
+	return c.line
+}
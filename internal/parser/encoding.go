@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Кодировки входных файлов
+const (
+	EncodingAuto    = "auto"
+	EncodingUTF8    = "utf-8"
+	EncodingCP1251  = "windows-1251"
+	EncodingKOI8R   = "koi8-r"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+// ErrUnknownEncoding - кодировка из конфига не поддерживается
+var ErrUnknownEncoding = errors.New("unknown encoding")
+
+var encodings = map[string]encoding.Encoding{
+	EncodingUTF8:    unicode.UTF8, // битые последовательности заменяются на U+FFFD
+	"utf8":          unicode.UTF8,
+	EncodingCP1251:  charmap.Windows1251,
+	"cp1251":        charmap.Windows1251,
+	EncodingKOI8R:   charmap.KOI8R,
+	"koi8r":         charmap.KOI8R,
+	"utf-16":        unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	EncodingUTF16LE: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	EncodingUTF16BE: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+}
+
+// CheckEncoding - поддерживается ли кодировка из конфига (пустая и auto - определить по файлу).
+// Проверяется при старте: опечатка в конфиге иначе всплывет только на каждом входном файле
+func CheckEncoding(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == EncodingAuto {
+		return nil
+	}
+	if _, ok := encodings[name]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownEncoding, name)
+	}
+	return nil
+}
+
+// сколько байт смотрим для определения кодировки
+const sniffSize = 4096
+
+// decode - оборачивает файл так, чтобы дальше читался UTF-8.
+// BOM в начале файла важнее настройки: файл сам говорит, в чем он записан.
+// Без BOM берется кодировка из настройки, а в режиме auto (или без настройки)
+// валидный UTF-8 читается как есть, UTF-16 узнается по нулевым байтам,
+// все остальное считается Windows-1251 - так пишут наши SCADA. Если в первых
+// sniffSize байтах только ASCII, решение откладывается до первого не-ASCII байта.
+// Возвращает reader и имя кодировки, с которой файл читается
+func decode(r io.Reader, name string) (io.Reader, string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return transform.NewReader(br, unicode.UTF8BOM.NewDecoder()), EncodingUTF8, nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return transform.NewReader(br, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder()), EncodingUTF16LE, nil
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return transform.NewReader(br, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder()), EncodingUTF16BE, nil
+	}
+
+	if name == "" || name == EncodingAuto {
+		name = sniffEncoding(head)
+
+		// в начале файла только ASCII, а файл длиннее окна: кириллица может
+		// встретиться дальше, кодировка определится по ней
+		if name == EncodingUTF8 && len(head) == sniffSize && indexNonASCII(head) < 0 {
+			return &lateSniffReader{br: br, encoding: EncodingUTF8}, EncodingUTF8, nil
+		}
+	}
+
+	enc, ok := encodings[name]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownEncoding, name)
+	}
+
+	return transform.NewReader(br, enc.NewDecoder()), name, nil
+}
+
+// sniffEncoding - угадывает кодировку файла без BOM по первым байтам
+func sniffEncoding(head []byte) string {
+	if len(head) >= 2 && bytes.Count(head, []byte{0}) > len(head)/4 {
+		// в UTF-16 у табуляций, цифр и латиницы старший байт нулевой
+		if head[0] == 0 {
+			return EncodingUTF16BE
+		}
+		return EncodingUTF16LE
+	}
+
+	return sniffText(head)
+}
+
+// sniffText - UTF-8 или Windows-1251 по окну байт, прочитанному через Peek
+func sniffText(head []byte) string {
+	// Peek мог разрезать последний символ, его не проверяем
+	if i := bytes.LastIndexByte(head, '\n'); i >= 0 && len(head) == sniffSize {
+		head = head[:i]
+	}
+
+	if utf8.Valid(head) {
+		return EncodingUTF8
+	}
+
+	return EncodingCP1251
+}
+
+// indexNonASCII - индекс первого байта не из ASCII, -1 если таких нет
+func indexNonASCII(data []byte) int {
+	for i, b := range data {
+		if b >= utf8.RuneSelf {
+			return i
+		}
+	}
+	return -1
+}
+
+// lateSniffReader - файл в режиме auto, у которого первые sniffSize байт - чистый ASCII.
+// ASCII одинаков в UTF-8 и Windows-1251, поэтому отдается как есть, а на первом не-ASCII
+// байте кодировка определяется по окну sniffSize байт с него, и дальше файл читается через декодер
+type lateSniffReader struct {
+	br       *bufio.Reader
+	decoded  io.Reader // nil, пока не встретился не-ASCII байт
+	encoding string
+}
+
+func (l *lateSniffReader) Read(p []byte) (int, error) {
+	if l.decoded != nil {
+		return l.decoded.Read(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if l.br.Buffered() == 0 {
+		if _, err := l.br.Peek(1); err != nil {
+			return 0, err
+		}
+	}
+
+	buffered, _ := l.br.Peek(l.br.Buffered())
+	switch i := indexNonASCII(buffered); {
+	case i < 0:
+		return l.br.Read(p[:min(len(p), len(buffered))])
+	case i > 0:
+		return l.br.Read(p[:min(len(p), i)])
+	}
+
+	window, err := l.br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return 0, err
+	}
+
+	l.encoding = sniffText(window)
+	l.decoded = transform.NewReader(l.br, encodings[l.encoding].NewDecoder())
+	return l.decoded.Read(p)
+}
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownFormat - формат файла не удалось определить ни по расширению, ни по содержимому
+var ErrUnknownFormat = errors.New("unknown input format")
+
+// RowReader - построчное чтение файла конкретного формата.
+// Первые строки - заголовки с именами колонок, дальше данные
+type RowReader interface {
+	// Read - следующая строка как набор значений, io.EOF когда строки закончились.
+	// Битую строку, после которой чтение можно продолжить, возвращает как *RowError
+	Read() ([]string, error)
+
+	// Line - номер последней прочитанной строки в файле
+	Line() int
+}
+
+// RowError - одна строка файла не читается, остальные можно читать дальше
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Format - формат входных файлов: по каким расширениям узнается и как читается
+type Format struct {
+	Name       string
+	Extensions []string // с точкой: ".tsv"
+
+	// Text - текстовый формат, перед чтением перекодируется в UTF-8 (см. Options.Encoding)
+	Text bool
+
+	// Sniff - похоже ли начало файла на этот формат, для файлов с незнакомым расширением
+	Sniff func(head []byte) bool
+
+	// Open - построчное чтение содержимого. Если RowReader еще и io.Closer, Stream закроет его
+	Open func(r io.Reader) (RowReader, error)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+// Register - добавляет формат в реестр, более поздняя регистрация перекрывает расширения более ранней
+func Register(format Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats = append(formats, format)
+}
+
+func init() {
+	Register(Format{
+		Name:       "tsv",
+		Extensions: []string{".tsv"},
+		Text:       true,
+		Open:       delimitedRows('\t'),
+	})
+	Register(Format{
+		Name:       "csv",
+		Extensions: []string{".csv"},
+		Text:       true,
+		Sniff:      sniffDelimited,
+		Open:       sniffedDelimitedRows,
+	})
+	Register(Format{
+		Name:       "jsonl",
+		Extensions: []string{".jsonl", ".ndjson"},
+		Text:       true,
+		Sniff:      sniffJSONL,
+		Open:       jsonlRows,
+	})
+	Register(Format{
+		Name:       "xlsx",
+		Extensions: []string{".xlsx"},
+		Sniff:      sniffXLSX,
+		Open:       xlsxRows,
+	})
+}
+
+// Supported - есть ли формат для файла с таким расширением (.gz снаружи не мешает).
+// Файлы без расширения не берутся: в input/ и zip это обычно README и прочие посторонние файлы,
+// а не выгрузки, и их повторы только засоряли бы processed_files
+func Supported(fileName string) bool {
+	_, ok := formatByName(fileName)
+	return ok
+}
+
+// fileExt - расширение файла в нижнем регистре, .gz снимается
+func fileExt(fileName string) string {
+	return filepath.Ext(strings.TrimSuffix(strings.ToLower(fileName), ".gz"))
+}
+
+// formatByName - формат по расширению файла, .gz снимается
+func formatByName(fileName string) (Format, bool) {
+	ext := fileExt(fileName)
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for i := len(formats) - 1; i >= 0; i-- {
+		for _, e := range formats[i].Extensions {
+			if e == ext {
+				return formats[i], true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// formatByContent - формат по первым байтам, когда расширение ничего не говорит
+func formatByContent(head []byte) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for i := len(formats) - 1; i >= 0; i-- {
+		if formats[i].Sniff != nil && formats[i].Sniff(head) {
+			return formats[i], true
+		}
+	}
+	return Format{}, false
+}
+
+// detectFormat - формат по расширению, а если оно незнакомо - по содержимому.
+// Возвращает reader, с которого можно читать с самого начала
+func detectFormat(r io.Reader, fileName string) (Format, io.Reader, error) {
+	if format, ok := formatByName(fileName); ok {
+		return format, r, nil
+	}
+
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return Format{}, nil, err
+	}
+
+	format, ok := formatByContent(head)
+	if !ok {
+		return Format{}, nil, fmt.Errorf("%w: %s", ErrUnknownFormat, fileName)
+	}
+	return format, br, nil
+}
+
+func sniffXLSX(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("PK\x03\x04"))
+}
+
+func sniffJSONL(head []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n\xef\xbb\xbf"), []byte("{"))
+}
+
+func sniffDelimited(head []byte) bool {
+	return bytes.ContainsAny(firstLine(head), "\t;,")
+}
+
+func firstLine(head []byte) []byte {
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		return head[:i]
+	}
+	return head
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// jsonlHeader - колонки JSON Lines: ключи объектов совпадают с json полями DeviceMessage
+var jsonlHeader = []string{
+	ColumnNumber, ColumnMqtt, ColumnInvid, ColumnUnitGUID, ColumnMessageID, ColumnMessageText,
+	ColumnContext, ColumnMessageClass, ColumnLevel, ColumnArea, ColumnAddress,
+}
+
+// maxJSONLine - самая длинная строка JSON Lines, которую готовы прочитать
+const maxJSONLine = 1 << 20
+
+// jsonlReader - JSON Lines, по одному DeviceMessage в строке.
+// Заголовка в файле нет, поэтому первой строкой отдается jsonlHeader
+type jsonlReader struct {
+	scanner    *bufio.Scanner
+	line       int
+	headerSent bool
+}
+
+func jsonlRows(r io.Reader) (RowReader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLine)
+
+	return &jsonlReader{scanner: scanner}, nil
+}
+
+func (j *jsonlReader) Read() ([]string, error) {
+	if !j.headerSent {
+		j.headerSent = true
+		return jsonlHeader, nil
+	}
+
+	if !j.scanner.Scan() {
+		if err := j.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	j.line++
+
+	data := bytes.TrimSpace(j.scanner.Bytes())
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return nil, &RowError{Line: j.line, Err: fmt.Errorf("invalid JSON: %w", err)}
+	}
+
+	values := make(map[string]any, len(object))
+	for key, value := range object {
+		values[normalizeHeader(key)] = value
+	}
+
+	record := make([]string, len(jsonlHeader))
+	for i, column := range jsonlHeader {
+		record[i] = jsonString(values[column])
+	}
+
+	return record, nil
+}
+
+func (j *jsonlReader) Line() int {
+	return j.line
+}
+
+func jsonString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+}
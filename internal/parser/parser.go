@@ -1,88 +1,60 @@
 package parser
 
 import (
-	"encoding/csv"
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/alonsoF100/reporting-service/internal/models"
 )
 
-func ParseTSV(filePath string) (*models.ParseResult, error) {
-	const op = "parser.ParseTSV"
+// Parse - читает файл любого зарегистрированного формата целиком со стандартными именами колонок,
+// невалидные строки пропускает. Для больших файлов лучше Open.
+// Файл без единой строки данных - ошибка ErrNoMessages (в *ParseError), что с ним делать, решает вызывающий
+func Parse(filePath string) (*models.ParseResult, error) {
+	const op = "parser.Parse"
 
 	logger := slog.With(
 		slog.String("op", op),
 		slog.String("file", filePath),
 	)
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		logger.Error("failed to open file",
-			slog.String("error", err.Error()),
-		)
-		return nil, fmt.Errorf("%s: %w", op, err)
+	result := &models.ParseResult{
+		FileName: filePath,
+		Messages: []models.DeviceMessage{},
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.Comma = '\t'
-	reader.FieldsPerRecord = 11 // всегда 11 колонок!
 
-	records, err := reader.ReadAll()
+	stream, err := Open(filePath, Options{})
 	if err != nil {
-		logger.Error("failed read CSV",
+		logger.Error("failed to open file",
 			slog.String("error", err.Error()),
 		)
-		return nil, fmt.Errorf("%s: failed read CSV: %w", op, err)
-	}
-
-	logger.Info("File loaded",
-		slog.Int("total_rows", len(records)),
-	)
-
-	if len(records) < 3 {
-		logger.Error("file too short",
-			slog.Int("rows", len(records)),
-		)
-		return nil, fmt.Errorf("%s: file too short, need at least 3 rows", op)
-	}
-
-	result := &models.ParseResult{
-		FileName: filePath,
-		Messages: []models.DeviceMessage{},
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer stream.Close()
 
-	// Пропускаем первые 2 строки (описание и заголовки)
-	for i := 2; i < len(records); i++ {
-		record := records[i]
-
-		if len(record) == 0 || (len(record) == 1 && record[0] == "") {
-			continue
+	for {
+		batch, err := stream.Next(1000)
+		if err == io.EOF {
+			break
 		}
-
-		msg := models.DeviceMessage{
-			Number:       parseInt(record[0]),
-			Mqtt:         strings.TrimSpace(record[1]),
-			Invid:        strings.TrimSpace(record[2]),
-			UnitGUID:     strings.TrimSpace(record[3]),
-			MessageID:    strings.TrimSpace(record[4]),
-			MessageText:  strings.TrimSpace(record[5]),
-			Context:      strings.TrimSpace(record[6]),
-			MessageClass: strings.TrimSpace(record[7]),
-			Level:        parseInt(record[8]),
-			Area:         strings.TrimSpace(record[9]),
-			Address:      strings.TrimSpace(record[10]),
+		if err != nil {
+			logger.Error("failed read file",
+				slog.String("error", err.Error()),
+			)
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-
-		result.Messages = append(result.Messages, msg)
+		result.Messages = append(result.Messages, batch...)
 	}
 
+	result.Rejected = stream.Rejected()
+
 	logger.Info("parsing completed",
+		slog.Int("total_rows", stream.Rows()),
 		slog.Int("parsed_messages", len(result.Messages)),
+		slog.Int("rejected_rows", stream.RejectedCount()),
 	)
 
 	return result, nil
@@ -0,0 +1,352 @@
+package parser
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+)
+
+// ErrNoMessages - в файле нет ни одной строки с данными
+var ErrNoMessages = errors.New("no messages found in file")
+
+// ParseError - файл нельзя загрузить из-за его содержимого: незнакомый формат, битый gzip,
+// нет заголовка или данных, невалидная строка в строгом режиме. Повтор не поможет, пока файл не исправят.
+// Ошибки ввода-вывода при чтении файла в ParseError не оборачиваются - они временные
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// invalidContent - оборачивает ошибку чтения в ParseError, если виновато содержимое файла, а не диск
+func invalidContent(err error) error {
+	var (
+		pathErr  *fs.PathError
+		parseErr *ParseError
+	)
+	if err == nil || errors.As(err, &pathErr) || errors.As(err, &parseErr) {
+		return err
+	}
+	return &ParseError{Err: err}
+}
+
+// Stream - потоковое чтение файла пачками, в памяти держится только текущая пачка
+type Stream struct {
+	closers    []io.Closer // закрываются в Close, сначала читатель формата, потом файл
+	rowReader  RowReader
+	format     string
+	encoding   string
+	sniffer    *lateSniffReader // кодировка определяется по ходу чтения, см. decode
+	sourceFile string
+	columns    columnIndex
+	validator  *validator
+	strict     bool
+	rows       int                   // сколько строк файла прочитано, включая заголовки
+	peeked     *models.DeviceMessage // первая строка данных, прочитанная при открытии
+
+	rejected      []models.RejectedRow // первые maxRejected отклоненных строк
+	rejectedCount int
+}
+
+// maxRejected - сколько отклоненных строк файла хранить, чтобы совсем битый файл не съел память
+const maxRejected = 1000
+
+// headerRows - в скольких первых строках ищем заголовок: в выгрузках контроллеров
+// первая строка - описание для людей, вторая - машинные имена колонок
+const headerRows = 2
+
+// Open - открывает файл любого зарегистрированного формата (в том числе сжатый .gz)
+// для потокового чтения, см. NewStream
+func Open(filePath string, opts Options) (*Stream, error) {
+	const op = "parser.Open"
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var r io.Reader = file
+	closers := []io.Closer{file}
+
+	if strings.EqualFold(filepath.Ext(filePath), ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: gzip: %w", op, invalidContent(err))
+		}
+		r = gz
+		closers = []io.Closer{gz, file}
+	}
+
+	s, err := NewStream(r, filepath.Base(filePath), opts)
+	if err != nil {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	s.closers = append(s.closers, closers...)
+
+	return s, nil
+}
+
+// NewStream - читает файл из r: формат определяется по расширению sourceFile, а если оно
+// незнакомо - по содержимому. Колонки сопоставляются по заголовку (одна из первых двух строк),
+// и проверяется, что есть хотя бы одна строка данных, чтобы пустой файл отсекался до записи в БД.
+// sourceFile попадает в SourceFile сообщений. r закрывает вызывающий, если Stream создан не через Open
+func NewStream(r io.Reader, sourceFile string, opts Options) (*Stream, error) {
+	const op = "parser.NewStream"
+
+	format, r, err := detectFormat(r, sourceFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, invalidContent(err))
+	}
+
+	// текстовые форматы дальше всегда читаются в UTF-8, в какой бы кодировке ни пришел файл
+	encodingName := ""
+	var sniffer *lateSniffReader
+	if format.Text {
+		r, encodingName, err = decode(r, opts.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, invalidContent(err))
+		}
+		sniffer, _ = r.(*lateSniffReader)
+	}
+
+	rowReader, err := format.Open(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, format.Name, invalidContent(err))
+	}
+
+	s := &Stream{
+		rowReader:  rowReader,
+		format:     format.Name,
+		encoding:   encodingName,
+		sniffer:    sniffer,
+		sourceFile: sourceFile,
+		validator:  newValidator(opts.Classes),
+		strict:     opts.Strict,
+	}
+	if closer, ok := rowReader.(io.Closer); ok {
+		s.closers = []io.Closer{closer}
+	}
+
+	if err := s.readHeader(opts.Columns); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("%s: %w", op, invalidContent(err))
+	}
+
+	msg, err := s.next()
+	if err != nil {
+		s.Close()
+		if err == io.EOF && s.rejectedCount > 0 {
+			first := s.rejected[0]
+			return nil, fmt.Errorf("%s: %w", op, &ParseError{Err: fmt.Errorf("%w, all %d rows rejected, first at line %d: %s",
+				ErrNoMessages, s.rejectedCount, first.Row, first.Reason)})
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: %w", op, &ParseError{Err: ErrNoMessages})
+		}
+		return nil, fmt.Errorf("%s: %w", op, invalidContent(err))
+	}
+	s.peeked = &msg
+
+	return s, nil
+}
+
+// readHeader - ищет заголовок в первых headerRows строках: первая строка,
+// в которой нашлись обязательные колонки. Строки до него пропускаются
+func (s *Stream) readHeader(extra Columns) error {
+	var mapErr error
+
+	for i := 0; i < headerRows; i++ {
+		record, err := s.read()
+		if err == io.EOF {
+			if mapErr != nil {
+				return mapErr
+			}
+			return errors.New("file too short, need header and data rows")
+		}
+		if err != nil {
+			return fmt.Errorf("failed read header: %w", err)
+		}
+
+		columns, unknown, err := mapHeader(record, extra)
+		if err != nil {
+			mapErr = err
+			continue
+		}
+		s.columns = columns
+
+		if len(unknown) > 0 {
+			slog.Info("unknown columns ignored",
+				slog.String("op", "parser.Stream.readHeader"),
+				slog.String("file", s.sourceFile),
+				slog.Any("columns", unknown),
+			)
+		}
+		return nil
+	}
+
+	return mapErr
+}
+
+// Next - следующая пачка не больше batchSize сообщений, io.EOF когда файл закончился
+func (s *Stream) Next(batchSize int) ([]models.DeviceMessage, error) {
+	batch := make([]models.DeviceMessage, 0, batchSize)
+
+	if s.peeked != nil {
+		batch = append(batch, *s.peeked)
+		s.peeked = nil
+	}
+
+	for len(batch) < batchSize {
+		msg, err := s.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parser.Stream.Next: %w", invalidContent(err))
+		}
+		batch = append(batch, msg)
+	}
+
+	if len(batch) == 0 {
+		return nil, io.EOF
+	}
+
+	return batch, nil
+}
+
+// Batches - функция для репозитория, отдающая файл пачками по batchSize
+func (s *Stream) Batches(batchSize int) models.NextBatch {
+	return func() ([]models.DeviceMessage, error) {
+		return s.Next(batchSize)
+	}
+}
+
+// Format - формат файла из реестра (tsv, csv, jsonl, xlsx)
+func (s *Stream) Format() string {
+	return s.format
+}
+
+// Encoding - кодировка, в которой читается текстовый файл, пусто для двоичных форматов.
+// Если начало файла - чистый ASCII, до первого не-ASCII байта здесь utf-8
+func (s *Stream) Encoding() string {
+	if s.sniffer != nil {
+		return s.sniffer.encoding
+	}
+	return s.encoding
+}
+
+// Rows - сколько строк файла прочитано на данный момент, для отчета о прогрессе
+func (s *Stream) Rows() int {
+	return s.rows
+}
+
+// Rejected - отклоненные строки (не больше maxRejected), полный список готов, когда Next вернул io.EOF
+func (s *Stream) Rejected() []models.RejectedRow {
+	return s.rejected
+}
+
+// RejectedCount - сколько строк отклонено всего
+func (s *Stream) RejectedCount() int {
+	return s.rejectedCount
+}
+
+func (s *Stream) Close() error {
+	var errs []error
+	for _, c := range s.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// next - следующая непустая строка данных, прошедшая проверку
+func (s *Stream) next() (models.DeviceMessage, error) {
+	for {
+		record, err := s.read()
+
+		var rowErr *RowError
+		if errors.As(err, &rowErr) && !s.strict {
+			s.reject(rowErr.Line, rowErr.Err.Error(), nil)
+			continue
+		}
+		if err == io.EOF {
+			return models.DeviceMessage{}, err
+		}
+		if err != nil {
+			return models.DeviceMessage{}, fmt.Errorf("failed read %s: %w", s.format, err)
+		}
+
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+
+		line := s.rowReader.Line()
+
+		if reasons := s.validator.check(s.columns, record); len(reasons) > 0 {
+			reason := strings.Join(reasons, "; ")
+			if s.strict {
+				return models.DeviceMessage{}, fmt.Errorf("%w: line %d: %s", ErrInvalidRow, line, reason)
+			}
+			s.reject(line, reason, record)
+			continue
+		}
+
+		return models.DeviceMessage{
+			Number:       parseInt(s.columns.value(record, ColumnNumber)),
+			Mqtt:         s.columns.value(record, ColumnMqtt),
+			Invid:        s.columns.value(record, ColumnInvid),
+			UnitGUID:     s.columns.value(record, ColumnUnitGUID),
+			MessageID:    s.columns.value(record, ColumnMessageID),
+			MessageText:  s.columns.value(record, ColumnMessageText),
+			Context:      s.columns.value(record, ColumnContext),
+			MessageClass: s.columns.value(record, ColumnMessageClass),
+			Level:        parseInt(s.columns.value(record, ColumnLevel)),
+			Area:         s.columns.value(record, ColumnArea),
+			Address:      s.columns.value(record, ColumnAddress),
+			SourceFile:   s.sourceFile,
+			SourceRow:    line,
+		}, nil
+	}
+}
+
+// reject - запоминает отклоненную строку
+func (s *Stream) reject(line int, reason string, record []string) {
+	s.rejectedCount++
+	if len(s.rejected) >= maxRejected {
+		return
+	}
+
+	s.rejected = append(s.rejected, models.RejectedRow{
+		FileName: s.sourceFile,
+		Row:      line,
+		Reason:   reason,
+		Content:  strings.Join(record, "\t"),
+	})
+}
+
+func (s *Stream) read() ([]string, error) {
+	record, err := s.rowReader.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	// битая строка тоже прочитана
+	s.rows++
+	return record, err
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRow - строка не прошла проверку, в строгом режиме файл целиком не загружается
+var ErrInvalidRow = errors.New("invalid row")
+
+// DefaultMessageClasses - классы сообщений, которые шлют контроллеры
+var DefaultMessageClasses = []string{"alarm", "warning", "info", "event", "comand", "waiting", "working"}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validator - проверка строк файла до записи в БД
+type validator struct {
+	classes map[string]struct{}
+}
+
+func newValidator(classes []string) *validator {
+	if len(classes) == 0 {
+		classes = DefaultMessageClasses
+	}
+
+	v := &validator{classes: make(map[string]struct{}, len(classes))}
+	for _, class := range classes {
+		v.classes[strings.ToLower(strings.TrimSpace(class))] = struct{}{}
+	}
+	return v
+}
+
+// check - причины, по которым строку нельзя загрузить, пусто если строка в порядке
+func (v *validator) check(columns columnIndex, record []string) []string {
+	var reasons []string
+
+	if unitGUID := columns.value(record, ColumnUnitGUID); !uuidPattern.MatchString(unitGUID) {
+		reasons = append(reasons, fmt.Sprintf("unit_guid %q is not a UUID", unitGUID))
+	}
+
+	if columns.value(record, ColumnMessageID) == "" {
+		reasons = append(reasons, "message_id is empty")
+	}
+
+	// класс и уровень проверяем, только если такие колонки есть в файле
+	if _, ok := columns[ColumnMessageClass]; ok {
+		class := columns.value(record, ColumnMessageClass)
+		if _, known := v.classes[strings.ToLower(class)]; !known {
+			reasons = append(reasons, fmt.Sprintf("unknown message class %q", class))
+		}
+	}
+
+	if _, ok := columns[ColumnLevel]; ok {
+		level := columns.value(record, ColumnLevel)
+		if _, err := strconv.Atoi(level); err != nil {
+			reasons = append(reasons, fmt.Sprintf("level %q is not an integer", level))
+		}
+	}
+
+	return reasons
+}
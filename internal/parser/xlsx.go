@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxReader - первый лист книги XLSX, заголовки в первых строках как у TSV
+type xlsxReader struct {
+	file *excelize.File
+	rows *excelize.Rows
+	line int
+}
+
+func xlsxRows(r io.Reader) (RowReader, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("open xlsx: %w", err)
+	}
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		file.Close()
+		return nil, errors.New("xlsx has no sheets")
+	}
+
+	rows, err := file.Rows(sheets[0])
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("read sheet %q: %w", sheets[0], err)
+	}
+
+	return &xlsxReader{file: file, rows: rows}, nil
+}
+
+func (x *xlsxReader) Read() ([]string, error) {
+	if !x.rows.Next() {
+		if err := x.rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	x.line++
+
+	record, err := x.rows.Columns()
+	if err != nil {
+		return nil, &RowError{Line: x.line, Err: err}
+	}
+	return record, nil
+}
+
+func (x *xlsxReader) Line() int {
+	return x.line
+}
+
+func (x *xlsxReader) Close() error {
+	return errors.Join(x.rows.Close(), x.file.Close())
+}
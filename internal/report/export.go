@@ -0,0 +1,251 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/xuri/excelize/v2"
+)
+
+// exportHeader - колонки выгрузки: все поля DeviceMessage, файл-источник со строкой и время загрузки
+var exportHeader = []string{
+	"number", "mqtt", "invid", "unit_guid", "message_id", "message_text",
+	"context", "message_class", "level", "area", "address",
+	"source_file", "source_row", "created_at",
+}
+
+const (
+	xlsxMessagesSheet = "Сообщения"
+	xlsxSummarySheet  = "Сводка"
+)
+
+// utf8BOM - без BOM Excel открывает UTF-8 CSV как cp1251 и ломает кириллицу
+const utf8BOM = "\uFEFF"
+
+// CSVRenderer - выгрузка истории сообщений в CSV
+type CSVRenderer struct{}
+
+func NewCSVRenderer() *CSVRenderer {
+	return &CSVRenderer{}
+}
+
+func (r *CSVRenderer) Extension() string {
+	return FormatCSV
+}
+
+func (r *CSVRenderer) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+// Render - пишет сообщения устройства в CSV, первая строка - заголовки
+func (r *CSVRenderer) Render(device Device, messages []models.DeviceMessage) ([]byte, error) {
+	const op = "report.CSVRenderer.Render"
+
+	var buf bytes.Buffer
+	buf.WriteString(utf8BOM)
+
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(exportHeader); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, msg := range messages {
+		if err := writer.Write(exportRow(msg)); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// XLSXRenderer - выгрузка истории сообщений в Excel с листом сводки
+type XLSXRenderer struct{}
+
+func NewXLSXRenderer() *XLSXRenderer {
+	return &XLSXRenderer{}
+}
+
+func (r *XLSXRenderer) Extension() string {
+	return FormatXLSX
+}
+
+func (r *XLSXRenderer) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+// Render - пишет сообщения на лист "Сообщения", а счетчики по классам и уровням на лист "Сводка"
+func (r *XLSXRenderer) Render(device Device, messages []models.DeviceMessage) ([]byte, error) {
+	const op = "report.XLSXRenderer.Render"
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName("Sheet1", xlsxMessagesSheet); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := writeXLSXMessages(f, messages); err != nil {
+		return nil, fmt.Errorf("%s: messages sheet: %w", op, err)
+	}
+
+	if err := writeXLSXSummary(f, device, messages); err != nil {
+		return nil, fmt.Errorf("%s: summary sheet: %w", op, err)
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeXLSXMessages - потоковая запись сообщений, чтобы большие выгрузки не держать в памяти дважды
+func writeXLSXMessages(f *excelize.File, messages []models.DeviceMessage) error {
+	sw, err := f.NewStreamWriter(xlsxMessagesSheet)
+	if err != nil {
+		return err
+	}
+
+	header := make([]any, len(exportHeader))
+	for i, h := range exportHeader {
+		header[i] = h
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return err
+	}
+
+	for i, msg := range messages {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+
+		row := []any{
+			msg.Number, msg.Mqtt, msg.Invid, msg.UnitGUID,
+			msg.MessageID, msg.MessageText, msg.Context,
+			msg.MessageClass, msg.Level, msg.Area, msg.Address,
+			msg.SourceFile, msg.SourceRow, formatExportTime(msg.CreatedAt),
+		}
+		if err := sw.SetRow(cell, row); err != nil {
+			return err
+		}
+	}
+
+	return sw.Flush()
+}
+
+// writeXLSXSummary - лист со сводкой по устройству: количество сообщений по классам и уровням
+func writeXLSXSummary(f *excelize.File, device Device, messages []models.DeviceMessage) error {
+	if _, err := f.NewSheet(xlsxSummarySheet); err != nil {
+		return err
+	}
+
+	byClass, byLevel := summarize(messages)
+
+	rows := [][]any{
+		{"Unit GUID", device.UnitGUID},
+		{"Инвентарный номер", device.Invid},
+		{"Всего сообщений", len(messages)},
+		{},
+		{"Класс сообщения", "Количество"},
+	}
+	for _, c := range byClass {
+		rows = append(rows, []any{c.key, c.count})
+	}
+
+	rows = append(rows, []any{}, []any{"Уровень сообщения", "Количество"})
+	for _, c := range byLevel {
+		rows = append(rows, []any{c.key, c.count})
+	}
+
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		if err := f.SetSheetRow(xlsxSummarySheet, cell, &row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportRow - строка выгрузки в порядке exportHeader
+func exportRow(msg models.DeviceMessage) []string {
+	return []string{
+		strconv.Itoa(msg.Number),
+		safeCell(msg.Mqtt),
+		safeCell(msg.Invid),
+		safeCell(msg.UnitGUID),
+		safeCell(msg.MessageID),
+		safeCell(msg.MessageText),
+		safeCell(msg.Context),
+		safeCell(msg.MessageClass),
+		strconv.Itoa(msg.Level),
+		safeCell(msg.Area),
+		safeCell(msg.Address),
+		safeCell(msg.SourceFile),
+		strconv.Itoa(msg.SourceRow),
+		formatExportTime(msg.CreatedAt),
+	}
+}
+
+// safeCell - текст от устройства, начинающийся с =, +, -, @ (или табуляции и возврата каретки),
+// Excel выполнит как формулу при открытии CSV. Апостроф в начале оставляет его просто текстом.
+// В XLSX не нужен: excelize пишет строки как текст, а не как формулы
+func safeCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// summaryCount - количество сообщений с одинаковым значением поля
+type summaryCount[K comparable] struct {
+	key   K
+	count int
+}
+
+// summarize - считает сообщения по классам (по алфавиту) и уровням (по возрастанию)
+func summarize(messages []models.DeviceMessage) ([]summaryCount[string], []summaryCount[int]) {
+	classes := make(map[string]int)
+	levels := make(map[int]int)
+	for _, msg := range messages {
+		classes[msg.MessageClass]++
+		levels[msg.Level]++
+	}
+
+	byClass := make([]summaryCount[string], 0, len(classes))
+	for k, v := range classes {
+		byClass = append(byClass, summaryCount[string]{key: k, count: v})
+	}
+	sort.Slice(byClass, func(i, j int) bool { return byClass[i].key < byClass[j].key })
+
+	byLevel := make([]summaryCount[int], 0, len(levels))
+	for k, v := range levels {
+		byLevel = append(byLevel, summaryCount[int]{key: k, count: v})
+	}
+	sort.Slice(byLevel, func(i, j int) bool { return byLevel[i].key < byLevel[j].key })
+
+	return byClass, byLevel
+}
@@ -0,0 +1,146 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+)
+
+// htmlTemplate - отчет в одном файле, стили и сортировка встроены,
+// чтобы он открывался на планшете без доступа к серверу
+const htmlTemplate = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Отчет по устройству {{.Device.UnitGUID}}</title>
+<style>
+	body { font-family: "DejaVu Sans", Arial, sans-serif; margin: 16px; color: #222; }
+	h1 { font-size: 22px; }
+	.info p { margin: 4px 0; }
+	table { border-collapse: collapse; width: 100%; margin-top: 16px; font-size: 14px; }
+	th, td { border: 1px solid #999; padding: 4px 6px; text-align: left; vertical-align: top; word-break: break-word; }
+	th { background: #eee; cursor: pointer; user-select: none; white-space: nowrap; }
+	th[data-order="asc"]::after { content: " ▲"; }
+	th[data-order="desc"]::after { content: " ▼"; }
+	td.num { text-align: center; }
+	tr.class-alarm { background: #f8d7da; }
+	tr.class-warning { background: #fff3cd; }
+	tr.class-info { background: #d1ecf1; }
+	tr.class-event { background: #e2e3f3; }
+	tr.class-comand { background: #e8daef; }
+	tr.class-waiting { background: #fdebd0; }
+	tr.class-working { background: #d4edda; }
+</style>
+</head>
+<body>
+<h1>Отчет по устройству</h1>
+<div class="info">
+	<p>Unit GUID: {{.Device.UnitGUID}}</p>
+	{{- if .Device.Invid}}
+	<p>Инвентарный номер: {{.Device.Invid}}</p>
+	{{- end}}
+	<p>Всего сообщений: {{len .Messages}}</p>
+	<p>Дата отчета: {{.GeneratedAt}}</p>
+</div>
+<table id="messages">
+<thead>
+<tr>
+	<th data-type="number">№</th>
+	<th>Сообщение</th>
+	<th>Класс</th>
+	<th data-type="number">Уровень</th>
+	<th>Адрес</th>
+</tr>
+</thead>
+<tbody>
+{{- range $i, $msg := .Messages}}
+<tr class="{{cssClass $msg.MessageClass}}">
+	<td class="num">{{inc $i}}</td>
+	<td>{{$msg.MessageText}}</td>
+	<td>{{$msg.MessageClass}}</td>
+	<td class="num">{{$msg.Level}}</td>
+	<td>{{$msg.Address}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("#messages th").forEach(function (th, col) {
+	th.addEventListener("click", function () {
+		var tbody = document.querySelector("#messages tbody");
+		var numeric = th.dataset.type === "number";
+		var asc = th.dataset.order !== "asc";
+		document.querySelectorAll("#messages th").forEach(function (h) { delete h.dataset.order; });
+		th.dataset.order = asc ? "asc" : "desc";
+		Array.from(tbody.rows).sort(function (a, b) {
+			var x = a.cells[col].textContent, y = b.cells[col].textContent;
+			var cmp = numeric ? Number(x) - Number(y) : x.localeCompare(y, "ru");
+			return asc ? cmp : -cmp;
+		}).forEach(function (row) { tbody.appendChild(row); });
+	});
+});
+</script>
+</body>
+</html>
+`
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"inc":      func(i int) int { return i + 1 },
+	"cssClass": cssClass,
+}).Parse(htmlTemplate))
+
+// HTMLRenderer - отчет в виде HTML страницы для просмотра в браузере
+type HTMLRenderer struct{}
+
+func NewHTMLRenderer() *HTMLRenderer {
+	return &HTMLRenderer{}
+}
+
+func (r *HTMLRenderer) Extension() string {
+	return FormatHTML
+}
+
+func (r *HTMLRenderer) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+// Render - генерирует HTML с данными устройства
+func (r *HTMLRenderer) Render(device Device, messages []models.DeviceMessage) ([]byte, error) {
+	const op = "report.HTMLRenderer.Render"
+
+	data := struct {
+		Device      Device
+		Messages    []models.DeviceMessage
+		GeneratedAt string
+	}{
+		Device:      device,
+		Messages:    messages,
+		GeneratedAt: time.Now().Format("02.01.2006 15:04:05"),
+	}
+
+	var buf bytes.Buffer
+	if err := htmlReport.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// cssClass - CSS класс строки по классу сообщения, лишние символы отбрасываются
+func cssClass(messageClass string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(messageClass)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "class-unknown"
+	}
+	return "class-" + b.String()
+}
@@ -0,0 +1,214 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pdfColumn - колонка таблицы сообщений в PDF отчете
+type pdfColumn struct {
+	title string
+	width float64
+	align string
+}
+
+// колонки таблицы сообщений, в сумме ширина страницы A4 без полей
+var pdfColumns = []pdfColumn{
+	{title: "№", width: 15, align: "C"},
+	{title: "Сообщение", width: 70, align: "L"},
+	{title: "Класс", width: 30, align: "L"},
+	{title: "Уровень", width: 20, align: "C"},
+	{title: "Адрес", width: 55, align: "L"},
+}
+
+const (
+	pdfLineHeight   = 5.0  // высота строки текста внутри ячейки
+	pdfHeaderHeight = 7.0  // высота заголовка таблицы
+	pdfBottomMargin = 15.0 // нижнее поле под номер страницы
+)
+
+// PDFRenderer - отчет в PDF, шрифты DejaVu нужны для кириллицы
+type PDFRenderer struct {
+	fontsDir string
+}
+
+func NewPDFRenderer(fontsDir string) *PDFRenderer {
+	return &PDFRenderer{
+		fontsDir: fontsDir,
+	}
+}
+
+func (r *PDFRenderer) Extension() string {
+	return FormatPDF
+}
+
+func (r *PDFRenderer) ContentType() string {
+	return "application/pdf"
+}
+
+// Render - генерирует PDF с данными устройства
+func (r *PDFRenderer) Render(device Device, messages []models.DeviceMessage) ([]byte, error) {
+	const op = "report.PDFRenderer.Render"
+
+	// Создаем PDF
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(false, pdfBottomMargin)
+	pdf.AliasNbPages("{nb}")
+
+	// Добавляем шрифт с поддержкой кириллицы (DejaVu)
+	pdf.AddUTF8Font("DejaVu", "", filepath.Join(r.fontsDir, "DejaVuSans.ttf"))
+	pdf.AddUTF8Font("DejaVuBold", "", filepath.Join(r.fontsDir, "DejaVuSans-Bold.ttf"))
+
+	// Заголовок таблицы повторяется на каждой странице, кроме первой,
+	// где он рисуется после информации об устройстве
+	tableStarted := false
+	pdf.SetHeaderFunc(func() {
+		if tableStarted {
+			drawPDFTableHeader(pdf)
+		}
+	})
+
+	// Номер страницы в подвале, {nb} заменяется на общее число страниц
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfBottomMargin + 5)
+		pdf.SetFont("DejaVu", "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("стр. %d из {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+
+	// Заголовок - жирный шрифт
+	pdf.SetFont("DejaVuBold", "", 16)
+	pdf.Cell(0, 10, "Отчет по устройству")
+	pdf.Ln(15)
+
+	// Информация об устройстве - обычный шрифт
+	pdf.SetFont("DejaVu", "", 11)
+	pdf.Cell(0, 7, "Unit GUID: "+device.UnitGUID)
+	pdf.Ln(8)
+
+	if device.Invid != "" {
+		pdf.Cell(0, 7, "Инвентарный номер: "+device.Invid)
+		pdf.Ln(8)
+	}
+
+	pdf.Cell(0, 7, "Всего сообщений: "+fmt.Sprint(len(messages)))
+	pdf.Ln(8)
+
+	pdf.Cell(0, 7, "Дата отчета: "+time.Now().Format("02.01.2006 15:04:05"))
+	pdf.Ln(15)
+
+	drawPDFTableHeader(pdf)
+	tableStarted = true
+
+	_, pageHeight := pdf.GetPageSize()
+	_, top, _, _ := pdf.GetMargins()
+	pageBottom := pageHeight - pdfBottomMargin
+	// сколько места под строки на странице с повторенным заголовком таблицы
+	bodyHeight := pageBottom - top - pdfHeaderHeight
+
+	for i, msg := range messages {
+		// Длинные значения переносятся по словам, а не обрезаются
+		pdf.SetFont("DejaVu", "", 9)
+		cells := [][]string{
+			{fmt.Sprint(i + 1)},
+			splitPDFText(pdf, msg.MessageText, pdfColumns[1].width),
+			splitPDFText(pdf, msg.MessageClass, pdfColumns[2].width),
+			{fmt.Sprint(msg.Level)},
+			splitPDFText(pdf, msg.Address, pdfColumns[4].width),
+		}
+
+		rowHeight := pdfRowHeight(cells)
+
+		// Строка не влезает - переносим ее целиком на новую страницу
+		if pdf.GetY()+rowHeight > pageBottom && rowHeight <= bodyHeight {
+			pdf.AddPage()
+			pdf.SetFont("DejaVu", "", 9)
+		}
+
+		// Строка выше целой страницы - режем ее по страницам, иначе она залезет на подвал
+		for pdf.GetY()+rowHeight > pageBottom {
+			fit := int((pageBottom - pdf.GetY() - 2) / pdfLineHeight)
+			if fit > 0 {
+				var head [][]string
+				head, cells = splitPDFCells(cells, fit)
+				drawPDFRow(pdf, head, pdfRowHeight(head))
+				rowHeight = pdfRowHeight(cells)
+			}
+			pdf.AddPage()
+			pdf.SetFont("DejaVu", "", 9)
+		}
+
+		drawPDFRow(pdf, cells, rowHeight)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// drawPDFTableHeader - рисует заголовок таблицы сообщений
+func drawPDFTableHeader(pdf *gofpdf.Fpdf) {
+	pdf.SetFont("DejaVuBold", "", 10)
+	for _, col := range pdfColumns {
+		pdf.CellFormat(col.width, pdfHeaderHeight, col.title, "1", 0, "C", false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("DejaVu", "", 9)
+}
+
+// drawPDFRow - рисует строку таблицы, каждая ячейка может быть в несколько строк
+func drawPDFRow(pdf *gofpdf.Fpdf, cells [][]string, rowHeight float64) {
+	x, y := pdf.GetXY()
+
+	for i, col := range pdfColumns {
+		pdf.Rect(x, y, col.width, rowHeight, "D")
+		for j, line := range cells[i] {
+			pdf.SetXY(x, y+1+float64(j)*pdfLineHeight)
+			pdf.CellFormat(col.width, pdfLineHeight, line, "", 0, col.align, false, 0, "")
+		}
+		x += col.width
+	}
+
+	left, _, _, _ := pdf.GetMargins()
+	pdf.SetXY(left, y+rowHeight)
+}
+
+// pdfRowHeight - высота строки таблицы по самой длинной ячейке
+func pdfRowHeight(cells [][]string) float64 {
+	lines := 1
+	for _, cell := range cells {
+		lines = max(lines, len(cell))
+	}
+	return float64(lines)*pdfLineHeight + 2
+}
+
+// splitPDFCells - делит строку таблицы на первые n строк текста каждой ячейки и остаток
+func splitPDFCells(cells [][]string, n int) (head, tail [][]string) {
+	for _, cell := range cells {
+		if len(cell) <= n {
+			head = append(head, cell)
+			tail = append(tail, []string{""})
+			continue
+		}
+		head = append(head, cell[:n])
+		tail = append(tail, cell[n:])
+	}
+	return head, tail
+}
+
+// splitPDFText - разбивает текст на строки по ширине колонки с учетом рун
+func splitPDFText(pdf *gofpdf.Fpdf, text string, width float64) []string {
+	if text == "" {
+		return []string{""}
+	}
+	return pdf.SplitText(text, width)
+}
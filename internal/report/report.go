@@ -0,0 +1,70 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+)
+
+const (
+	FormatPDF  = "pdf"
+	FormatHTML = "html"
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Device - данные устройства, по которому строится отчет
+type Device struct {
+	UnitGUID string
+	Invid    string
+}
+
+// NewDevice - собирает данные устройства, инвентарный номер берется из первого сообщения
+func NewDevice(unitGUID string, messages []models.DeviceMessage) Device {
+	device := Device{UnitGUID: unitGUID}
+	if len(messages) > 0 {
+		device.Invid = messages[0].Invid
+	}
+	return device
+}
+
+// Renderer - формирует отчет по устройству в конкретном формате
+type Renderer interface {
+	// Отрисовать отчет по устройству и его сообщениям
+	Render(device Device, messages []models.DeviceMessage) ([]byte, error)
+
+	// Расширение файла отчета без точки (pdf, html, ...)
+	Extension() string
+
+	// MIME тип отчета для отдачи по HTTP
+	ContentType() string
+}
+
+// NewRenderer - создает рендерер по названию формата
+func NewRenderer(format, fontsDir string) (Renderer, error) {
+	switch format {
+	case FormatPDF:
+		return NewPDFRenderer(fontsDir), nil
+	case FormatHTML:
+		return NewHTMLRenderer(), nil
+	case FormatCSV:
+		return NewCSVRenderer(), nil
+	case FormatXLSX:
+		return NewXLSXRenderer(), nil
+	default:
+		return nil, fmt.Errorf("report.NewRenderer: %w %q", models.ErrUnknownFormat, format)
+	}
+}
+
+// NewRenderers - создает рендереры для всех форматов из конфига
+func NewRenderers(formats []string, fontsDir string) ([]Renderer, error) {
+	renderers := make([]Renderer, 0, len(formats))
+	for _, format := range formats {
+		renderer, err := NewRenderer(format, fontsDir)
+		if err != nil {
+			return nil, err
+		}
+		renderers = append(renderers, renderer)
+	}
+	return renderers, nil
+}
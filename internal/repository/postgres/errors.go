@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TransientError - сбой обращения к БД: нет соединения, таймаут, конфликт блокировок.
+// С данными файла все в порядке, попытку стоит повторить позже
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// DataError - БД отвергла данные файла: значение не влезает в колонку, не того формата,
+// пустое там, где обязательно, или не проходит CHECK. Повтор с тем же файлом упадет так же
+type DataError struct {
+	Err error
+}
+
+func (e *DataError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DataError) Unwrap() error {
+	return e.Err
+}
+
+// dbError - оборачивает ошибку БД в DataError или TransientError по SQLSTATE.
+// Из класса 23 к данным файла относятся только not_null_violation и check_violation:
+// unique_violation и foreign_key_violation возникают из-за гонки с параллельной записью
+// или удаленной строки, и повтор может пройти
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "22"): // data exception
+			return &DataError{Err: err}
+		case pgErr.Code == "23502", pgErr.Code == "23514": // not_null_violation, check_violation
+			return &DataError{Err: err}
+		}
+	}
+	return &TransientError{Err: err}
+}
@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBError(t *testing.T) {
+	tests := []struct {
+		code      string
+		permanent bool
+	}{
+		{"22001", true},  // string_data_right_truncation
+		{"22P02", true},  // invalid_text_representation
+		{"23502", true},  // not_null_violation
+		{"23514", true},  // check_violation
+		{"23505", false}, // unique_violation: гонка с параллельной загрузкой
+		{"23503", false}, // foreign_key_violation: строку удалили между чтением и записью
+		{"40001", false}, // serialization_failure
+		{"08006", false}, // connection_failure
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			err := dbError(fmt.Errorf("copy: %w", &pgconn.PgError{Code: tt.code}))
+
+			var (
+				dataErr      *DataError
+				transientErr *TransientError
+			)
+			assert.Equal(t, tt.permanent, errors.As(err, &dataErr))
+			assert.Equal(t, !tt.permanent, errors.As(err, &transientErr))
+		})
+	}
+
+	// не ошибка PostgreSQL - сбой соединения и т.п.
+	var transientErr *TransientError
+	assert.ErrorAs(t, dbError(errors.New("connection reset by peer")), &transientErr)
+	assert.NoError(t, dbError(nil))
+}
@@ -2,12 +2,17 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // ----------------------------------------------------------------------------
@@ -26,13 +31,84 @@ func (r *Repository) UpdateFileStatus(ctx context.Context, fileName, status, err
 
 	logger.Info("updating file status")
 
+	if err := upsertFileStatus(ctx, r.pool, fileName, status, errorMsg); err != nil {
+		logger.Error("failed to update file status", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("file status updated")
+	return nil
+}
+
+// StartFileAttempt - ставит файлу статус processing, увеличивает счетчик попыток и выдает
+// воркеру аренду на lease: пока воркер продлевает ее через HeartbeatFile, файл считается в работе.
+// Возвращает номер текущей попытки
+func (r *Repository) StartFileAttempt(ctx context.Context, fileName, workerID string, lease time.Duration) (int, error) {
+	const op = "postgres.StartFileAttempt"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.String("worker_id", workerID),
+	)
+
+	now := time.Now()
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
 	query, args, err := psql.
 		Insert("processed_files").
-		Columns("file_name", "status", "error_message", "processed_at").
-		Values(fileName, status, errorMsg, time.Now()).
-		Suffix("ON CONFLICT (file_name) DO UPDATE SET status = $2, error_message = $3, processed_at = $4").
+		Columns("file_name", "status", "error_message", "attempts", "worker_id", "heartbeat_at", "lease_expires_at", "processed_at").
+		Values(fileName, models.StatusProcessing, "", 1, workerID, now, now.Add(lease), now).
+		Suffix(`ON CONFLICT (file_name) DO UPDATE SET
+			status = EXCLUDED.status,
+			attempts = processed_files.attempts + 1,
+			worker_id = EXCLUDED.worker_id,
+			heartbeat_at = EXCLUDED.heartbeat_at,
+			lease_expires_at = EXCLUDED.lease_expires_at,
+			processed_at = EXCLUDED.processed_at
+		RETURNING attempts`).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	var attempts int
+	if err := r.pool.QueryRow(ctx, query, args...).Scan(&attempts); err != nil {
+		logger.Error("failed to start file attempt", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("file attempt started", slog.Int("attempt", attempts))
+	return attempts, nil
+}
+
+// AbortFileAttempt - откатывает попытку, прерванную остановкой сервиса: она не засчитывается,
+// аренда снимается и файл сразу возвращается в queued. Файл, который уже не у этого воркера, не трогается
+func (r *Repository) AbortFileAttempt(ctx context.Context, fileName, workerID string) error {
+	const op = "postgres.AbortFileAttempt"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.String("worker_id", workerID),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Update("processed_files").
+		Set("status", models.StatusQueued).
+		Set("attempts", sq.Expr("GREATEST(attempts - 1, 0)")).
+		Set("worker_id", nil).
+		Set("lease_expires_at", nil).
+		Set("processed_at", time.Now()).
+		Where(sq.Eq{
+			"file_name": fileName,
+			"worker_id": workerID,
+			"status":    models.StatusProcessing,
+		}).
 		ToSql()
 
 	if err != nil {
@@ -40,13 +116,357 @@ func (r *Repository) UpdateFileStatus(ctx context.Context, fileName, status, err
 		return fmt.Errorf("%s: build query: %w", op, err)
 	}
 
-	_, err = r.pool.Exec(ctx, query, args...)
+	tag, err := r.pool.Exec(ctx, query, args...)
 	if err != nil {
-		logger.Error("failed to update file status", slog.String("error", err.Error()))
+		logger.Error("failed to abort file attempt", slog.String("error", err.Error()))
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrLeaseLost)
+	}
 
-	logger.Info("file status updated")
+	logger.Info("file attempt aborted")
+	return nil
+}
+
+// ScheduleFileRetry - помечает упавшую попытку: статус error с причиной и категорией transient,
+// аренда снимается, следующая попытка не раньше retryAt
+func (r *Repository) ScheduleFileRetry(ctx context.Context, fileName, errorMsg string, retryAt time.Time) error {
+	const op = "postgres.ScheduleFileRetry"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.Time("next_retry_at", retryAt),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Update("processed_files").
+		Set("status", models.StatusError).
+		Set("error_message", errorMsg).
+		Set("error_category", models.ErrorTransient).
+		Set("next_retry_at", retryAt).
+		Set("worker_id", nil).
+		Set("lease_expires_at", nil).
+		Set("processed_at", time.Now()).
+		Where(sq.Eq{"file_name": fileName}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to schedule file retry", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w: %s", op, models.ErrFileNotFound, fileName)
+	}
+
+	logger.Info("file retry scheduled")
+	return nil
+}
+
+// MarkFileFailed - ставит файлу терминальный статус failed: автоматически он больше не берется.
+// category - почему: permanent (дело в файле) или transient (попытки исчерпаны на сбоях).
+// Записи о файле может еще не быть, если задание упало до того, как файл был забран
+func (r *Repository) MarkFileFailed(ctx context.Context, fileName, category, errorMsg string) error {
+	const op = "postgres.MarkFileFailed"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.String("category", category),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Insert("processed_files").
+		Columns("file_name", "status", "error_message", "error_category", "processed_at").
+		Values(fileName, models.StatusFailed, errorMsg, category, time.Now()).
+		Suffix(`ON CONFLICT (file_name) DO UPDATE SET
+			status = EXCLUDED.status,
+			error_message = EXCLUDED.error_message,
+			error_category = EXCLUDED.error_category,
+			processed_at = EXCLUDED.processed_at,
+			next_retry_at = NULL,
+			worker_id = NULL,
+			lease_expires_at = NULL`).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	if _, err := r.pool.Exec(ctx, query, args...); err != nil {
+		logger.Error("failed to mark file as failed", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("file marked as failed")
+	return nil
+}
+
+// ClaimFile - забирает файл в работу воркеру workerID, чтобы при нескольких репликах на общей
+// папке input файл обработала ровно одна. Строка файла блокируется через FOR UPDATE SKIP LOCKED:
+// если ее держит другая транзакция, файл не забирается. Забранный файл получает статус processing
+// и аренду на lease. Возвращает, забран ли файл, и текущую запись о нем (nil, если ее нет или она занята)
+func (r *Repository) ClaimFile(
+	ctx context.Context,
+	fileName, contentHash, workerID string,
+	lease time.Duration,
+) (bool, *models.ProcessedFile, error) {
+	const op = "postgres.ClaimFile"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.String("worker_id", workerID),
+	)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		logger.Error("failed to begin transaction", slog.String("error", err.Error()))
+		return false, nil, fmt.Errorf("%s: begin: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Select(processedFileColumns...).
+		From("processed_files").
+		Where(sq.Eq{"file_name": fileName}).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return false, nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	// строку забираем, если она свободна и ее можно брать в работу. Если строки не нашлось,
+	// ее либо нет, либо держит другая реплика: вставка без конфликта различит эти случаи
+	onConflict := "ON CONFLICT (file_name) DO NOTHING"
+
+	current, err := scanProcessedFile(tx.QueryRow(ctx, query, args...))
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		logger.Error("failed to lock file", slog.String("error", err.Error()))
+		return false, nil, fmt.Errorf("%s: %w", op, err)
+	case !current.Claimable(contentHash, now, lease):
+		logger.Debug("file is not claimable", slog.String("status", current.Status))
+		return false, &current, nil
+	default:
+		onConflict = `ON CONFLICT (file_name) DO UPDATE SET
+			status = EXCLUDED.status,
+			worker_id = EXCLUDED.worker_id,
+			heartbeat_at = EXCLUDED.heartbeat_at,
+			lease_expires_at = EXCLUDED.lease_expires_at,
+			processed_at = EXCLUDED.processed_at`
+	}
+
+	query, args, err = psql.
+		Insert("processed_files").
+		Columns("file_name", "status", "error_message", "worker_id", "heartbeat_at", "lease_expires_at", "processed_at").
+		Values(fileName, models.StatusProcessing, "", workerID, now, now.Add(lease), now).
+		Suffix(onConflict).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return false, nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to claim file", slog.String("error", err.Error()))
+		return false, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		logger.Debug("file is locked by another replica")
+		return false, nil, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Error("failed to commit transaction", slog.String("error", err.Error()))
+		return false, nil, fmt.Errorf("%s: commit: %w", op, err)
+	}
+
+	logger.Info("file claimed")
+	return true, nil, nil
+}
+
+// HeartbeatFile - продлевает аренду файла воркером еще на lease.
+// models.ErrLeaseLost, если файл уже не в processing у этого воркера (например, его забрал реапер)
+func (r *Repository) HeartbeatFile(ctx context.Context, fileName, workerID string, lease time.Duration) error {
+	const op = "postgres.HeartbeatFile"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.String("worker_id", workerID),
+	)
+
+	now := time.Now()
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Update("processed_files").
+		Set("heartbeat_at", now).
+		Set("lease_expires_at", now.Add(lease)).
+		Where(sq.Eq{
+			"file_name": fileName,
+			"worker_id": workerID,
+			"status":    models.StatusProcessing,
+		}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to extend lease", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrLeaseLost)
+	}
+
+	logger.Debug("lease extended")
+	return nil
+}
+
+// ReapExpiredLeases - возвращает в статус queued файлы, застрявшие в processing: аренда истекла,
+// или ее нет вовсе (записи до аренды, файл упал до первой попытки), а статус не менялся дольше lease.
+// Файлы из zip не трогаются - они перезагружаются вместе со своим архивом. Попытка упавшего
+// воркера остается засчитанной, откатывается только остановка сервиса (AbortFileAttempt).
+// Возвращает имена возвращенных в очередь файлов
+func (r *Repository) ReapExpiredLeases(ctx context.Context, lease time.Duration) ([]string, error) {
+	const op = "postgres.ReapExpiredLeases"
+
+	logger := r.logger.With(slog.String("op", op))
+
+	now := time.Now()
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Update("processed_files").
+		Set("status", models.StatusQueued).
+		Set("error_message", sq.Expr("'lease expired, worker ' || COALESCE(worker_id, 'unknown') || ' did not finish'")).
+		Set("worker_id", nil).
+		Set("lease_expires_at", nil).
+		Set("processed_at", now).
+		Where(sq.And{
+			sq.Eq{"status": models.StatusProcessing, "archive_path": nil},
+			sq.Or{
+				sq.Lt{"lease_expires_at": now},
+				sq.And{
+					sq.Eq{"lease_expires_at": nil},
+					sq.Lt{"processed_at": now.Add(-lease)},
+				},
+			},
+		}).
+		Suffix("RETURNING file_name").
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to reap expired leases", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var files []string
+
+	for rows.Next() {
+		var fileName string
+		if err := rows.Scan(&fileName); err != nil {
+			logger.Error("failed to scan row", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		files = append(files, fileName)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to reap expired leases", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(files) > 0 {
+		logger.Warn("expired leases reaped", slog.Int("count", len(files)))
+	}
+	return files, nil
+}
+
+// RequeueFile - возвращает файл в статус queued для повторной загрузки:
+// ошибка прошлой обработки и счетчик попыток сбрасываются.
+// Файл, который воркер держит по действующей аренде, не трогается - models.ErrFileBusy
+func (r *Repository) RequeueFile(ctx context.Context, fileName string) error {
+	const op = "postgres.RequeueFile"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+	)
+
+	now := time.Now()
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Update("processed_files").
+		Set("status", models.StatusQueued).
+		Set("error_message", "").
+		Set("attempts", 0).
+		Set("worker_id", nil).
+		Set("lease_expires_at", nil).
+		Set("next_retry_at", nil).
+		Set("error_category", nil).
+		Set("processed_at", now).
+		Where(sq.And{
+			sq.Eq{"file_name": fileName},
+			sq.Or{
+				sq.NotEq{"status": models.StatusProcessing},
+				sq.Eq{"lease_expires_at": nil},
+				sq.Lt{"lease_expires_at": now},
+			},
+		}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to requeue file", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := r.GetProcessedFile(ctx, fileName); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return fmt.Errorf("%s: %w: %s", op, models.ErrFileBusy, fileName)
+	}
+
+	logger.Info("file requeued")
 	return nil
 }
 
@@ -60,79 +480,688 @@ func (r *Repository) GetAllProcessedFiles(ctx context.Context) ([]models.Process
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
 	query, args, err := psql.
-		Select("id", "file_name", "status", "error_message", "processed_at", "created_at").
-		From("processed_files").
-		OrderBy("processed_at DESC").
+		Select(processedFileColumns...).
+		From("processed_files").
+		OrderBy("processed_at DESC").
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to query processed files", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var files []models.ProcessedFile
+
+	for rows.Next() {
+		f, err := scanProcessedFile(rows)
+		if err != nil {
+			logger.Error("failed to scan row", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to read rows", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("processed files retrieved", slog.Int("count", len(files)))
+	return files, nil
+}
+
+// GetProcessedFileByID - запись о файле по id, models.ErrFileNotFound если файла нет
+func (r *Repository) GetProcessedFileByID(ctx context.Context, id int64) (*models.ProcessedFile, error) {
+	const op = "postgres.GetProcessedFileByID"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.Int64("id", id),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Select(processedFileColumns...).
+		From("processed_files").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	f, err := scanProcessedFile(r.pool.QueryRow(ctx, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrFileNotFound)
+	}
+	if err != nil {
+		logger.Error("failed to query file", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &f, nil
+}
+
+// GetProcessedFile - запись о файле по имени, models.ErrFileNotFound если файла нет
+func (r *Repository) GetProcessedFile(ctx context.Context, fileName string) (*models.ProcessedFile, error) {
+	const op = "postgres.GetProcessedFile"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Select(processedFileColumns...).
+		From("processed_files").
+		Where(sq.Eq{"file_name": fileName}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	f, err := scanProcessedFile(r.pool.QueryRow(ctx, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrFileNotFound)
+	}
+	if err != nil {
+		logger.Error("failed to query file", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &f, nil
+}
+
+// ListProcessedFiles - файлы с фильтром по статусу (пустой - все) и пагинацией, свежие первыми
+func (r *Repository) ListProcessedFiles(ctx context.Context, status string, page, limit int) ([]models.ProcessedFile, int, error) {
+	const op = "postgres.ListProcessedFiles"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("status", status),
+		slog.Int("page", page),
+		slog.Int("limit", limit),
+	)
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	where := sq.And{}
+	if status != "" {
+		where = append(where, sq.Eq{"status": status})
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	countQuery, countArgs, err := psql.
+		Select("COUNT(*)").
+		From("processed_files").
+		Where(where).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build count query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s: build count query: %w", op, err)
+	}
+
+	var total int
+	if err := r.pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total); err != nil {
+		logger.Error("failed to get total count", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s: count query: %w", op, err)
+	}
+
+	query, args, err := psql.
+		Select(processedFileColumns...).
+		From("processed_files").
+		Where(where).
+		OrderBy("processed_at DESC", "id DESC").
+		Limit(uint64(limit)).
+		Offset(uint64((page - 1) * limit)).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to query processed files", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var files []models.ProcessedFile
+
+	for rows.Next() {
+		f, err := scanProcessedFile(rows)
+		if err != nil {
+			logger.Error("failed to scan row", slog.String("error", err.Error()))
+			return nil, 0, fmt.Errorf("%s: scan: %w", op, err)
+		}
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to read rows", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("processed files listed", slog.Int("count", len(files)), slog.Int("total", total))
+	return files, total, nil
+}
+
+// GetFileDetails - запись о файле и сводка по загруженному из него: число сообщений,
+// устройства и число отклоненных строк. Для zip учитываются сообщения всех его файлов
+func (r *Repository) GetFileDetails(ctx context.Context, fileName string) (*models.FileDetails, error) {
+	const op = "postgres.GetFileDetails"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+	)
+
+	file, err := r.GetProcessedFile(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &models.FileDetails{ProcessedFile: *file, Devices: []string{}}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	// сообщения файлов из zip лежат под <архив>/<путь внутри>: поиск по префиксу
+	// идет по индексу text_pattern_ops на source_file
+	fromFile := sq.Or{
+		sq.Eq{"source_file": fileName},
+		sq.Like{"source_file": likePrefix(fileName + "/")},
+	}
+
+	query, args, err := psql.
+		Select("unit_guid", "COUNT(*)").
+		From("device_messages").
+		Where(fromFile).
+		GroupBy("unit_guid").
+		OrderBy("unit_guid").
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to query file messages", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			unitGUID string
+			count    int
+		)
+		if err := rows.Scan(&unitGUID, &count); err != nil {
+			logger.Error("failed to scan row", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: scan: %w", op, err)
+		}
+
+		details.Devices = append(details.Devices, unitGUID)
+		details.Messages += count
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to read file messages", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// в rejected_rows лежат не все отклоненные строки, полное число - в processed_files;
+	// файлы из zip ссылаются на него через archive_path
+	query, args, err = psql.
+		Select("COALESCE(SUM(rejected_count), 0)").
+		From("processed_files").
+		Where(sq.Or{
+			sq.Eq{"file_name": fileName},
+			sq.Eq{"archive_path": fileName},
+		}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build count query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build count query: %w", op, err)
+	}
+
+	if err := r.pool.QueryRow(ctx, query, args...).Scan(&details.Rejected); err != nil {
+		logger.Error("failed to count rejected rows", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: count query: %w", op, err)
+	}
+
+	return details, nil
+}
+
+// GetProcessedFileByHash - ищет успешно обработанный файл с тем же содержимым, nil если такого нет
+func (r *Repository) GetProcessedFileByHash(ctx context.Context, contentHash string) (*models.ProcessedFile, error) {
+	const op = "postgres.GetProcessedFileByHash"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("content_hash", contentHash),
+	)
+
+	logger.Debug("looking up file by content hash")
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Select("id", "file_name", "status", "content_hash", "revision", "processed_at", "created_at").
+		From("processed_files").
+		Where(sq.Eq{"content_hash": contentHash, "status": models.StatusProcessed}).
+		OrderBy("processed_at").
+		Limit(1).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	var f models.ProcessedFile
+	err = r.pool.QueryRow(ctx, query, args...).Scan(
+		&f.ID,
+		&f.FileName,
+		&f.Status,
+		&f.ContentHash,
+		&f.Revision,
+		&f.ProcessedAt,
+		&f.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error("failed to query file by hash", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &f, nil
+}
+
+// SetFileHash - запоминает хеш содержимого файла и возвращает номер ревизии:
+// если под тем же именем раньше было другое содержимое, ревизия увеличивается,
+// а попытки прошлой ревизии перестают считаться
+func (r *Repository) SetFileHash(ctx context.Context, fileName, contentHash string) (int, error) {
+	const op = "postgres.SetFileHash"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.String("content_hash", contentHash),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Insert("processed_files").
+		Columns("file_name", "status", "error_message", "content_hash", "processed_at").
+		Values(fileName, models.StatusProcessing, "", contentHash, time.Now()).
+		Suffix(`ON CONFLICT (file_name) DO UPDATE SET
+			revision = CASE
+				WHEN processed_files.content_hash IS NOT NULL
+					AND processed_files.content_hash <> EXCLUDED.content_hash
+				THEN processed_files.revision + 1
+				ELSE processed_files.revision
+			END,
+			attempts = CASE
+				WHEN processed_files.content_hash IS NOT NULL
+					AND processed_files.content_hash <> EXCLUDED.content_hash
+				THEN 0
+				ELSE processed_files.attempts
+			END,
+			content_hash = EXCLUDED.content_hash,
+			duplicate_of = NULL
+		RETURNING revision`).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	var revision int
+	if err := r.pool.QueryRow(ctx, query, args...).Scan(&revision); err != nil {
+		logger.Error("failed to set file hash", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("file hash stored", slog.Int("revision", revision))
+	return revision, nil
+}
+
+// MarkFileDuplicate - помечает файл как дубликат уже загруженного файла с тем же содержимым
+func (r *Repository) MarkFileDuplicate(ctx context.Context, fileName, contentHash, duplicateOf string) error {
+	const op = "postgres.MarkFileDuplicate"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.String("duplicate_of", duplicateOf),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Insert("processed_files").
+		Columns("file_name", "status", "error_message", "content_hash", "duplicate_of", "processed_at").
+		Values(fileName, models.StatusDuplicate, "", contentHash, duplicateOf, time.Now()).
+		Suffix(`ON CONFLICT (file_name) DO UPDATE SET
+			status = EXCLUDED.status,
+			error_message = EXCLUDED.error_message,
+			content_hash = EXCLUDED.content_hash,
+			duplicate_of = EXCLUDED.duplicate_of,
+			processed_at = EXCLUDED.processed_at,
+			worker_id = NULL,
+			lease_expires_at = NULL`).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	if _, err := r.pool.Exec(ctx, query, args...); err != nil {
+		logger.Error("failed to mark file as duplicate", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("file marked as duplicate")
+	return nil
+}
+
+// RegisterArchiveEntry - заводит запись для TSV, извлеченного из zip, со ссылкой на архив
+func (r *Repository) RegisterArchiveEntry(ctx context.Context, fileName, archivePath string) error {
+	const op = "postgres.RegisterArchiveEntry"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.String("archive_path", archivePath),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Insert("processed_files").
+		Columns("file_name", "status", "error_message", "archive_path", "processed_at").
+		Values(fileName, models.StatusProcessing, "", archivePath, time.Now()).
+		Suffix(`ON CONFLICT (file_name) DO UPDATE SET
+			status = EXCLUDED.status,
+			error_message = EXCLUDED.error_message,
+			archive_path = EXCLUDED.archive_path,
+			processed_at = EXCLUDED.processed_at`).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	if _, err := r.pool.Exec(ctx, query, args...); err != nil {
+		logger.Error("failed to register archive entry", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("archive entry registered")
+	return nil
+}
+
+// IsFileProcessed - проверяет, обработан ли файл
+func (r *Repository) IsFileProcessed(ctx context.Context, fileName string) (bool, error) {
+	const op = "postgres.IsFileProcessed"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+	)
+
+	logger.Debug("checking if file is processed")
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Select("COUNT(*)").
+		From("processed_files").
+		Where(sq.Eq{"file_name": fileName}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	var count int
+	err = r.pool.QueryRow(ctx, query, args...).Scan(&count)
+	if err != nil {
+		logger.Error("failed to check file status", slog.String("error", err.Error()))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Debug("file status checked", slog.Bool("processed", count > 0))
+	return count > 0, nil
+}
+
+// ----------------------------------------------------------------------------
+// Jobs methods
+// ----------------------------------------------------------------------------
+
+// EnqueueJob - ставит файл в очередь jobs. На файл заводится одно задание: повторная постановка
+// только поднимает приоритет и, с force, делает задание принудительным и готовым к запуску сразу
+func (r *Repository) EnqueueJob(ctx context.Context, fileName string, priority int, force bool) error {
+	const op = "postgres.EnqueueJob"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.Int("priority", priority),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Insert("jobs").
+		Columns("file_name", "priority", "force", "next_run_at").
+		Values(fileName, priority, force, time.Now()).
+		Suffix(`ON CONFLICT (file_name) DO UPDATE SET
+			priority = GREATEST(jobs.priority, EXCLUDED.priority),
+			force = jobs.force OR EXCLUDED.force,
+			next_run_at = CASE WHEN EXCLUDED.force THEN EXCLUDED.next_run_at ELSE jobs.next_run_at END`).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	if _, err := r.pool.Exec(ctx, query, args...); err != nil {
+		logger.Error("failed to enqueue job", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Debug("job enqueued")
+	return nil
+}
+
+// DequeueJob - выдает воркеру самое приоритетное готовое задание и скрывает его от остальных
+// на visibility: если воркер не продлит его через ExtendJob и не завершит, задание снова станет видно.
+// Задания, занятые другими транзакциями, пропускаются (FOR UPDATE SKIP LOCKED). nil - готовых заданий нет
+func (r *Repository) DequeueJob(ctx context.Context, workerID string, visibility time.Duration) (*models.Job, error) {
+	const op = "postgres.DequeueJob"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("worker_id", workerID),
+	)
+
+	now := time.Now()
+
+	next, nextArgs, err := sq.
+		Select("id").
+		From("jobs").
+		Where(sq.And{
+			sq.LtOrEq{"next_run_at": now},
+			sq.Or{
+				sq.Eq{"locked_until": nil},
+				sq.Lt{"locked_until": now},
+			},
+		}).
+		OrderBy("priority DESC", "next_run_at", "id").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Update("jobs").
+		Set("locked_by", workerID).
+		Set("locked_until", now.Add(visibility)).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Where(sq.Expr("id = ("+next+")", nextArgs...)).
+		Suffix("RETURNING " + strings.Join(jobColumns, ", ")).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	job, err := scanJob(r.pool.QueryRow(ctx, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error("failed to dequeue job", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("job dequeued",
+		slog.Int64("job_id", job.ID),
+		slog.String("file", job.FileName),
+		slog.Int("attempt", job.Attempts))
+	return &job, nil
+}
+
+// ExtendJob - продлевает видимость задания воркером еще на visibility.
+// models.ErrLeaseLost, если задание уже не у этого воркера
+func (r *Repository) ExtendJob(ctx context.Context, id int64, workerID string, visibility time.Duration) error {
+	const op = "postgres.ExtendJob"
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Update("jobs").
+		Set("locked_until", time.Now().Add(visibility)).
+		Where(sq.Eq{"id": id, "locked_by": workerID}).
+		ToSql()
+
+	if err != nil {
+		return fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	tag, err := r.pool.Exec(ctx, query, args...)
+	if err != nil {
+		r.logger.Error("failed to extend job", slog.String("op", op), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrLeaseLost)
+	}
+
+	return nil
+}
+
+// CompleteJob - убирает выполненное задание из очереди
+func (r *Repository) CompleteJob(ctx context.Context, id int64, workerID string) error {
+	const op = "postgres.CompleteJob"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.Int64("job_id", id),
+		slog.String("worker_id", workerID),
+	)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Delete("jobs").
+		Where(sq.Eq{"id": id, "locked_by": workerID}).
 		ToSql()
 
 	if err != nil {
 		logger.Error("failed to build query", slog.String("error", err.Error()))
-		return nil, fmt.Errorf("%s: build query: %w", op, err)
-	}
-
-	rows, err := r.pool.Query(ctx, query, args...)
-	if err != nil {
-		logger.Error("failed to query processed files", slog.String("error", err.Error()))
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: build query: %w", op, err)
 	}
-	defer rows.Close()
-
-	var files []models.ProcessedFile
 
-	for rows.Next() {
-		var f models.ProcessedFile
-		err := rows.Scan(
-			&f.ID,
-			&f.FileName,
-			&f.Status,
-			&f.ErrorMessage,
-			&f.ProcessedAt,
-			&f.CreatedAt,
-		)
-		if err != nil {
-			logger.Error("failed to scan row", slog.String("error", err.Error()))
-			return nil, fmt.Errorf("%s: scan: %w", op, err)
-		}
-		files = append(files, f)
+	if _, err := r.pool.Exec(ctx, query, args...); err != nil {
+		logger.Error("failed to complete job", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	logger.Info("processed files retrieved", slog.Int("count", len(files)))
-	return files, nil
+	logger.Debug("job completed")
+	return nil
 }
 
-// IsFileProcessed - проверяет, обработан ли файл
-func (r *Repository) IsFileProcessed(ctx context.Context, fileName string) (bool, error) {
-	const op = "postgres.IsFileProcessed"
+// ReleaseJob - возвращает задание в очередь невыполненным: оно снова станет видно воркерам в runAt
+func (r *Repository) ReleaseJob(ctx context.Context, id int64, workerID string, runAt time.Time, reason string) error {
+	const op = "postgres.ReleaseJob"
 
 	logger := r.logger.With(
 		slog.String("op", op),
-		slog.String("file", fileName),
+		slog.Int64("job_id", id),
+		slog.String("worker_id", workerID),
 	)
 
-	logger.Debug("checking if file is processed")
-
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
 	query, args, err := psql.
-		Select("COUNT(*)").
-		From("processed_files").
-		Where(sq.Eq{"file_name": fileName}).
+		Update("jobs").
+		Set("locked_by", nil).
+		Set("locked_until", nil).
+		Set("next_run_at", runAt).
+		Set("last_error", reason).
+		Where(sq.Eq{"id": id, "locked_by": workerID}).
 		ToSql()
 
 	if err != nil {
 		logger.Error("failed to build query", slog.String("error", err.Error()))
-		return false, fmt.Errorf("%s: build query: %w", op, err)
+		return fmt.Errorf("%s: build query: %w", op, err)
 	}
 
-	var count int
-	err = r.pool.QueryRow(ctx, query, args...).Scan(&count)
-	if err != nil {
-		logger.Error("failed to check file status", slog.String("error", err.Error()))
-		return false, fmt.Errorf("%s: %w", op, err)
+	if _, err := r.pool.Exec(ctx, query, args...); err != nil {
+		logger.Error("failed to release job", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	logger.Debug("file status checked", slog.Bool("processed", count > 0))
-	return count > 0, nil
+	logger.Info("job released", slog.Time("next_run_at", runAt), slog.String("reason", reason))
+	return nil
 }
 
 // ----------------------------------------------------------------------------
@@ -155,69 +1184,186 @@ func (r *Repository) SaveMessages(ctx context.Context, messages []models.DeviceM
 
 	logger.Info("saving messages to database")
 
+	saved, err := copyMessages(ctx, r.pool, models.BatchOf(messages), "", time.Now())
+	if err != nil {
+		logger.Error("failed to save messages", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("messages saved successfully", slog.Int64("saved", saved))
+	return nil
+}
+
+// IngestFile - атомарно загружает файл: в одной транзакции удаляет сообщения,
+// загруженные из него раньше, сохраняет новые с привязкой source_file и ставит статус processed.
+// Повторная обработка того же файла после сбоя или рестарта не создает дублей,
+// а новые сообщения сохраняют created_at первой загрузки файла.
+// Сообщения читаются из next пачками прямо в COPY, возвращает число сохраненных строк.
+// rejected вызывается после того, как все сообщения прочитаны: его строки заменяют
+// отклоненные строки прошлой загрузки файла, а общее число отклоненных (сохраняются не все)
+// пишется в processed_files.rejected_count (nil - отклоненных нет).
+// Ошибки БД приходят как TransientError или DataError, ошибки next - как есть
+func (r *Repository) IngestFile(
+	ctx context.Context,
+	fileName string,
+	next models.NextBatch,
+	rejected func() ([]models.RejectedRow, int),
+) (int64, error) {
+	const op = "postgres.IngestFile"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+	)
+
+	logger.Info("ingesting file in transaction")
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		logger.Error("failed to begin transaction", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: begin: %w", op, dbError(err))
+	}
+	// после Commit откат ничего не делает
+	defer tx.Rollback(ctx)
+
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
-	query := psql.
-		Insert("device_messages").
-		Columns(
-			"number", "mqtt", "invid", "unit_guid", "message_id", "message_text",
-			"context", "message_class", "level", "area", "address", "created_at",
-		)
+	// время первой загрузки файла переживает повторную обработку:
+	// по created_at работают фильтры from/to, и reprocess не должен переносить сообщения в сегодня
+	query, args, err := psql.
+		Select("MIN(created_at)").
+		From("device_messages").
+		Where(sq.Eq{"source_file": fileName}).
+		ToSql()
 
-	for _, msg := range messages {
-		query = query.Values(
-			msg.Number,
-			msg.Mqtt,
-			msg.Invid,
-			msg.UnitGUID,
-			msg.MessageID,
-			msg.MessageText,
-			msg.Context,
-			msg.MessageClass,
-			msg.Level,
-			msg.Area,
-			msg.Address,
-			time.Now(),
-		)
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: build query: %w", op, err)
 	}
 
-	sql, args, err := query.ToSql()
+	var firstIngested *time.Time
+	if err := tx.QueryRow(ctx, query, args...).Scan(&firstIngested); err != nil {
+		logger.Error("failed to get first ingestion time", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: get first ingestion time: %w", op, dbError(err))
+	}
+
+	createdAt := time.Now()
+	if firstIngested != nil {
+		createdAt = *firstIngested
+	}
+
+	query, args, err = psql.
+		Delete("device_messages").
+		Where(sq.Eq{"source_file": fileName}).
+		ToSql()
+
 	if err != nil {
 		logger.Error("failed to build query", slog.String("error", err.Error()))
-		return fmt.Errorf("%s: build query: %w", op, err)
+		return 0, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to delete previous messages", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: delete previous messages: %w", op, dbError(err))
+	}
+
+	if tag.RowsAffected() > 0 {
+		logger.Info("previous messages of file removed", slog.Int64("deleted", tag.RowsAffected()))
+	}
+
+	query, args, err = psql.
+		Delete("rejected_rows").
+		Where(sq.Eq{"file_name": fileName}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		logger.Error("failed to delete previous rejected rows", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: delete previous rejected rows: %w", op, dbError(err))
 	}
 
-	_, err = r.pool.Exec(ctx, sql, args...)
+	saved, err := copyMessages(ctx, tx, next, fileName, createdAt)
 	if err != nil {
 		logger.Error("failed to save messages", slog.String("error", err.Error()))
-		return fmt.Errorf("%s: %w", op, err)
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	logger.Info("messages saved successfully", slog.Int("saved", len(messages)))
-	return nil
+	rejectedCount := 0
+	if rejected != nil {
+		rows, total := rejected()
+		if err := copyRejectedRows(ctx, tx, fileName, rows); err != nil {
+			logger.Error("failed to save rejected rows", slog.String("error", err.Error()))
+			return 0, fmt.Errorf("%s: %w", op, dbError(err))
+		}
+
+		rejectedCount = total
+		if total > 0 {
+			logger.Warn("file has rejected rows", slog.Int("rejected", total), slog.Int("stored", len(rows)))
+		}
+	}
+
+	if err := upsertFileStatus(ctx, tx, fileName, models.StatusProcessed, ""); err != nil {
+		logger.Error("failed to update file status", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, dbError(err))
+	}
+
+	query, args, err = psql.
+		Update("processed_files").
+		Set("rejected_count", rejectedCount).
+		Where(sq.Eq{"file_name": fileName}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		logger.Error("failed to store rejected count", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: store rejected count: %w", op, dbError(err))
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		logger.Error("failed to commit transaction", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: commit: %w", op, dbError(err))
+	}
+
+	logger.Info("file ingested", slog.Int64("saved", saved))
+	return saved, nil
 }
 
 // GetAllMessagesByUnitGUID - возвращает все сообщения устройства
 func (r *Repository) GetAllMessagesByUnitGUID(ctx context.Context, unitGUID string) ([]models.DeviceMessage, error) {
-	const op = "postgres.GetAllMessagesByUnitGUID"
+	return r.GetMessagesByUnitGUID(ctx, unitGUID, models.MessageFilter{})
+}
+
+// GetMessagesByUnitGUID - возвращает сообщения устройства с фильтром по периоду и классам
+func (r *Repository) GetMessagesByUnitGUID(
+	ctx context.Context,
+	unitGUID string,
+	filter models.MessageFilter,
+) ([]models.DeviceMessage, error) {
+	const op = "postgres.GetMessagesByUnitGUID"
 
 	logger := r.logger.With(
 		slog.String("op", op),
 		slog.String("unit_guid", unitGUID),
 	)
 
-	logger.Info("getting all messages for device")
+	logger.Info("getting messages for device")
 
 	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
 	query, args, err := psql.
-		Select(
-			"number", "mqtt", "invid", "unit_guid", "message_id", "message_text",
-			"context", "message_class", "level", "area", "address", "created_at",
-		).
+		Select(messageColumns...).
 		From("device_messages").
-		Where(sq.Eq{"unit_guid": unitGUID}).
-		OrderBy("created_at DESC").
+		Where(messageFilterWhere(unitGUID, filter)).
+		OrderBy("created_at DESC", "source_row").
 		ToSql()
 
 	if err != nil {
@@ -235,23 +1381,7 @@ func (r *Repository) GetAllMessagesByUnitGUID(ctx context.Context, unitGUID stri
 	var messages []models.DeviceMessage
 
 	for rows.Next() {
-		var msg models.DeviceMessage
-		var createdAt time.Time
-
-		err := rows.Scan(
-			&msg.Number,
-			&msg.Mqtt,
-			&msg.Invid,
-			&msg.UnitGUID,
-			&msg.MessageID,
-			&msg.MessageText,
-			&msg.Context,
-			&msg.MessageClass,
-			&msg.Level,
-			&msg.Area,
-			&msg.Address,
-			&createdAt,
-		)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			logger.Error("failed to scan row", slog.String("error", err.Error()))
 			return nil, fmt.Errorf("%s: scan: %w", op, err)
@@ -259,6 +1389,10 @@ func (r *Repository) GetAllMessagesByUnitGUID(ctx context.Context, unitGUID stri
 
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to read rows", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
 	logger.Info("messages retrieved", slog.Int("count", len(messages)))
 	return messages, nil
@@ -268,6 +1402,7 @@ func (r *Repository) GetAllMessagesByUnitGUID(ctx context.Context, unitGUID stri
 func (r *Repository) GetMessagesByUnitGUIDWithPagination(
 	ctx context.Context,
 	unitGUID string,
+	filter models.MessageFilter,
 	page, limit int,
 ) ([]models.DeviceMessage, int, error) {
 	const op = "postgres.GetMessagesByUnitGUIDWithPagination"
@@ -294,7 +1429,7 @@ func (r *Repository) GetMessagesByUnitGUIDWithPagination(
 	countQuery, countArgs, err := psql.
 		Select("COUNT(*)").
 		From("device_messages").
-		Where(sq.Eq{"unit_guid": unitGUID}).
+		Where(messageFilterWhere(unitGUID, filter)).
 		ToSql()
 
 	if err != nil {
@@ -310,13 +1445,10 @@ func (r *Repository) GetMessagesByUnitGUIDWithPagination(
 	}
 
 	query, args, err := psql.
-		Select(
-			"number", "mqtt", "invid", "unit_guid", "message_id", "message_text",
-			"context", "message_class", "level", "area", "address", "created_at",
-		).
+		Select(messageColumns...).
 		From("device_messages").
-		Where(sq.Eq{"unit_guid": unitGUID}).
-		OrderBy("created_at DESC").
+		Where(messageFilterWhere(unitGUID, filter)).
+		OrderBy("created_at DESC", "source_row").
 		Limit(uint64(limit)).
 		Offset(uint64(offset)).
 		ToSql()
@@ -336,23 +1468,7 @@ func (r *Repository) GetMessagesByUnitGUIDWithPagination(
 	var messages []models.DeviceMessage
 
 	for rows.Next() {
-		var msg models.DeviceMessage
-		var createdAt time.Time
-
-		err := rows.Scan(
-			&msg.Number,
-			&msg.Mqtt,
-			&msg.Invid,
-			&msg.UnitGUID,
-			&msg.MessageID,
-			&msg.MessageText,
-			&msg.Context,
-			&msg.MessageClass,
-			&msg.Level,
-			&msg.Area,
-			&msg.Address,
-			&createdAt,
-		)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			logger.Error("failed to scan row", slog.String("error", err.Error()))
 			return nil, 0, fmt.Errorf("%s: scan: %w", op, err)
@@ -360,6 +1476,10 @@ func (r *Repository) GetMessagesByUnitGUIDWithPagination(
 
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to read rows", slog.String("error", err.Error()))
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
 
 	logger.Info("messages retrieved with pagination",
 		slog.Int("count", len(messages)),
@@ -369,3 +1489,354 @@ func (r *Repository) GetMessagesByUnitGUIDWithPagination(
 
 	return messages, total, nil
 }
+
+// GetRejectedRows - отклоненные при загрузке строки файла с пагинацией.
+// Возвращает сколько строк сохранено (по ним идет пагинация) и сколько отклонено всего:
+// сохраняются только первые, так что total может быть больше stored.
+// models.ErrFileNotFound если файла нет
+func (r *Repository) GetRejectedRows(ctx context.Context, fileName string, page, limit int) ([]models.RejectedRow, int, int, error) {
+	const op = "postgres.GetRejectedRows"
+
+	logger := r.logger.With(
+		slog.String("op", op),
+		slog.String("file", fileName),
+		slog.Int("page", page),
+		slog.Int("limit", limit),
+	)
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	countQuery, countArgs, err := psql.
+		Select("f.rejected_count", "(SELECT COUNT(*) FROM rejected_rows r WHERE r.file_name = f.file_name)").
+		From("processed_files f").
+		Where(sq.Eq{"f.file_name": fileName}).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build count query", slog.String("error", err.Error()))
+		return nil, 0, 0, fmt.Errorf("%s: build count query: %w", op, err)
+	}
+
+	var stored, total int
+	err = r.pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total, &stored)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, 0, fmt.Errorf("%s: %w: %s", op, models.ErrFileNotFound, fileName)
+	}
+	if err != nil {
+		logger.Error("failed to get total count", slog.String("error", err.Error()))
+		return nil, 0, 0, fmt.Errorf("%s: count query: %w", op, err)
+	}
+	// записи старше счетчика в processed_files
+	total = max(total, stored)
+
+	query, args, err := psql.
+		Select("file_name", "row_number", "reason", "COALESCE(content, '')", "created_at").
+		From("rejected_rows").
+		Where(sq.Eq{"file_name": fileName}).
+		OrderBy("row_number").
+		Limit(uint64(limit)).
+		Offset(uint64((page - 1) * limit)).
+		ToSql()
+
+	if err != nil {
+		logger.Error("failed to build query", slog.String("error", err.Error()))
+		return nil, 0, 0, fmt.Errorf("%s: build query: %w", op, err)
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		logger.Error("failed to query rejected rows", slog.String("error", err.Error()))
+		return nil, 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var rejected []models.RejectedRow
+
+	for rows.Next() {
+		var row models.RejectedRow
+		if err := rows.Scan(&row.FileName, &row.Row, &row.Reason, &row.Content, &row.CreatedAt); err != nil {
+			logger.Error("failed to scan row", slog.String("error", err.Error()))
+			return nil, 0, 0, fmt.Errorf("%s: scan: %w", op, err)
+		}
+
+		rejected = append(rejected, row)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("failed to read rows", slog.String("error", err.Error()))
+		return nil, 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("rejected rows retrieved",
+		slog.Int("count", len(rejected)),
+		slog.Int("stored", stored),
+		slog.Int("total", total))
+	return rejected, stored, total, nil
+}
+
+// ----------------------------------------------------------------------------
+// Helpers
+// ----------------------------------------------------------------------------
+
+// likePrefix - шаблон LIKE для строк, начинающихся с prefix; % и _ в самом prefix экранируются
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+// processedFileColumns - колонки processed_files в порядке полей scanProcessedFile
+var processedFileColumns = []string{
+	"id", "file_name", "status", "COALESCE(error_message, '')",
+	"COALESCE(content_hash, '')", "revision", "COALESCE(duplicate_of, '')",
+	"COALESCE(archive_path, '')", "attempts", "processed_at", "created_at",
+	"COALESCE(worker_id, '')", "heartbeat_at", "lease_expires_at",
+	"next_retry_at", "COALESCE(error_category, '')", "rejected_count",
+}
+
+// scanProcessedFile - читает строку, выбранную по processedFileColumns
+func scanProcessedFile(row pgx.Row) (models.ProcessedFile, error) {
+	var f models.ProcessedFile
+
+	err := row.Scan(
+		&f.ID,
+		&f.FileName,
+		&f.Status,
+		&f.ErrorMessage,
+		&f.ContentHash,
+		&f.Revision,
+		&f.DuplicateOf,
+		&f.ArchivePath,
+		&f.Attempts,
+		&f.ProcessedAt,
+		&f.CreatedAt,
+		&f.WorkerID,
+		&f.HeartbeatAt,
+		&f.LeaseExpiresAt,
+		&f.NextRetryAt,
+		&f.ErrorCategory,
+		&f.RejectedCount,
+	)
+
+	return f, err
+}
+
+// jobColumns - колонки jobs в порядке полей scanJob
+var jobColumns = []string{
+	"id", "file_name", "priority", "force", "attempts", "next_run_at",
+	"COALESCE(locked_by, '')", "locked_until", "COALESCE(last_error, '')", "created_at",
+}
+
+// scanJob - читает строку, выбранную по jobColumns
+func scanJob(row pgx.Row) (models.Job, error) {
+	var job models.Job
+
+	err := row.Scan(
+		&job.ID,
+		&job.FileName,
+		&job.Priority,
+		&job.Force,
+		&job.Attempts,
+		&job.NextRunAt,
+		&job.LockedBy,
+		&job.LockedUntil,
+		&job.LastError,
+		&job.CreatedAt,
+	)
+
+	return job, err
+}
+
+// messageColumns - колонки device_messages в порядке полей scanMessage
+var messageColumns = []string{
+	"number", "mqtt", "invid", "unit_guid", "message_id", "message_text",
+	"context", "message_class", "level", "area", "address",
+	"COALESCE(source_file, '')", "COALESCE(source_row, 0)", "created_at",
+}
+
+// scanMessage - читает строку, выбранную по messageColumns
+func scanMessage(row pgx.Row) (models.DeviceMessage, error) {
+	var msg models.DeviceMessage
+
+	err := row.Scan(
+		&msg.Number,
+		&msg.Mqtt,
+		&msg.Invid,
+		&msg.UnitGUID,
+		&msg.MessageID,
+		&msg.MessageText,
+		&msg.Context,
+		&msg.MessageClass,
+		&msg.Level,
+		&msg.Area,
+		&msg.Address,
+		&msg.SourceFile,
+		&msg.SourceRow,
+		&msg.CreatedAt,
+	)
+
+	return msg, err
+}
+
+// messageFilterWhere - условие выборки сообщений устройства по фильтру
+func messageFilterWhere(unitGUID string, filter models.MessageFilter) sq.And {
+	where := sq.And{sq.Eq{"unit_guid": unitGUID}}
+	if !filter.From.IsZero() {
+		where = append(where, sq.GtOrEq{"created_at": filter.From})
+	}
+	if !filter.To.IsZero() {
+		where = append(where, sq.Lt{"created_at": filter.To})
+	}
+	if len(filter.Classes) > 0 {
+		where = append(where, sq.Eq{"message_class": filter.Classes})
+	}
+	if filter.SourceFile != "" {
+		where = append(where, sq.Eq{"source_file": filter.SourceFile})
+	}
+	return where
+}
+
+// execer - общее у пула и транзакции, чтобы запросы работали и там и там
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// upsertFileStatus - вставляет или обновляет статус файла в processed_files.
+// Смена статуса завершает аренду файла воркером, заново поставленный в очередь файл
+// начинает попытки с нуля
+func upsertFileStatus(ctx context.Context, db execer, fileName, status, errorMsg string) error {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+	query, args, err := psql.
+		Insert("processed_files").
+		Columns("file_name", "status", "error_message", "processed_at").
+		Values(fileName, status, errorMsg, time.Now()).
+		Suffix(`ON CONFLICT (file_name) DO UPDATE SET status = $2, error_message = $3, processed_at = $4,
+			worker_id = NULL, lease_expires_at = NULL, next_retry_at = NULL, error_category = NULL,
+			attempts = CASE WHEN $2 = 'queued' THEN 0 ELSE processed_files.attempts END`).
+		ToSql()
+
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	_, err = db.Exec(ctx, query, args...)
+	return err
+}
+
+// copier - общее у пула и транзакции для COPY
+type copier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// copyMessages - пишет сообщения через COPY: нет лимита в 65535 параметров
+// multi-row INSERT и файл на сотни тысяч строк уходит одним потоком.
+// Пачки берутся из next по мере отправки, так что весь файл в памяти не держится.
+// createdAt пишется в created_at всех сообщений
+func copyMessages(ctx context.Context, db copier, next models.NextBatch, sourceFile string, createdAt time.Time) (int64, error) {
+	columns := []string{
+		"number", "mqtt", "invid", "unit_guid", "message_id", "message_text",
+		"context", "message_class", "level", "area", "address",
+		"source_file", "source_row", "created_at",
+	}
+
+	rows := &batchSource{
+		next:       next,
+		sourceFile: sourceFile,
+		createdAt:  createdAt,
+	}
+
+	saved, err := db.CopyFrom(ctx, pgx.Identifier{"device_messages"}, columns, rows)
+	if rows.err != nil {
+		// упало чтение файла, а не БД - ошибку источника отдаем как есть
+		return 0, rows.err
+	}
+	return saved, dbError(err)
+}
+
+// batchSource - pgx.CopyFromSource поверх NextBatch
+type batchSource struct {
+	next       models.NextBatch
+	sourceFile string // если задан, перекрывает SourceFile сообщений
+	createdAt  time.Time
+
+	batch []models.DeviceMessage
+	idx   int
+	err   error
+}
+
+func (b *batchSource) Next() bool {
+	b.idx++
+	for b.idx >= len(b.batch) {
+		batch, err := b.next()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			b.err = err
+			return false
+		}
+		b.batch = batch
+		b.idx = 0
+	}
+	return true
+}
+
+func (b *batchSource) Values() ([]any, error) {
+	msg := b.batch[b.idx]
+
+	sourceFile := msg.SourceFile
+	if b.sourceFile != "" {
+		sourceFile = b.sourceFile
+	}
+
+	return []any{
+		msg.Number,
+		msg.Mqtt,
+		msg.Invid,
+		msg.UnitGUID,
+		msg.MessageID,
+		msg.MessageText,
+		msg.Context,
+		msg.MessageClass,
+		msg.Level,
+		msg.Area,
+		msg.Address,
+		nullIfEmpty(sourceFile),
+		msg.SourceRow,
+		b.createdAt,
+	}, nil
+}
+
+func (b *batchSource) Err() error {
+	return b.err
+}
+
+// copyRejectedRows - пишет отклоненные строки файла через COPY
+func copyRejectedRows(ctx context.Context, db copier, fileName string, rejected []models.RejectedRow) error {
+	if len(rejected) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	rows := pgx.CopyFromSlice(len(rejected), func(i int) ([]any, error) {
+		row := rejected[i]
+		return []any{fileName, row.Row, row.Reason, row.Content, now}, nil
+	})
+
+	_, err := db.CopyFrom(ctx, pgx.Identifier{"rejected_rows"},
+		[]string{"file_name", "row_number", "reason", "content", "created_at"}, rows)
+	return err
+}
+
+// nullIfEmpty - пустая строка пишется в БД как NULL
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
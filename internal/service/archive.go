@@ -0,0 +1,159 @@
+package service
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// quarantineReport - содержимое .error.json рядом с файлом в карантине
+type quarantineReport struct {
+	FileName string    `json:"file_name"`
+	Error    string    `json:"error"`
+	Category string    `json:"category"` // permanent или transient
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// archive - переносит обработанный файл в archive_dir/<дата>/, при archive_gzip сжимает его
+// (.gz и .zip переносятся как есть).
+// Без archive_dir файл остается в input
+func (s *Scanner) archive(filePath, fileName string) error {
+	const op = "service.Scanner.archive"
+
+	if s.cfg.Application.Archive == "" {
+		return nil
+	}
+
+	dir := filepath.Join(s.cfg.Application.Archive, time.Now().Format(time.DateOnly))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var err error
+	if s.cfg.Application.ArchiveGzip && !isCompressed(fileName) {
+		err = gzipFile(filePath, uniquePath(dir, fileName+".gz"))
+	} else {
+		err = moveFile(filePath, uniquePath(dir, fileName))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.removeReadyMarkers(fileName)
+	return nil
+}
+
+// quarantine - переносит файл, который больше не будет повторяться, в quarantine_dir и пишет рядом <file>.error.json
+func (s *Scanner) quarantine(filePath, fileName string, attempts int, cause error) error {
+	const op = "service.Scanner.quarantine"
+
+	if s.cfg.Application.Quarantine == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.cfg.Application.Quarantine, 0755); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	target := uniquePath(s.cfg.Application.Quarantine, fileName)
+	if err := moveFile(filePath, target); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := json.MarshalIndent(quarantineReport{
+		FileName: fileName,
+		Error:    cause.Error(),
+		Category: errorCategory(cause),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%s: marshal error report: %w", op, err)
+	}
+
+	if err := os.WriteFile(target+".error.json", data, 0644); err != nil {
+		return fmt.Errorf("%s: write error report: %w", op, err)
+	}
+
+	s.removeReadyMarkers(fileName)
+	return nil
+}
+
+// removeReadyMarkers - маркеры готовности больше не нужны, когда файл ушел из input
+func (s *Scanner) removeReadyMarkers(fileName string) {
+	for _, ext := range readyMarkerExts {
+		marker := filepath.Join(s.cfg.Application.Input, fileName+ext)
+		if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+			s.logger.Warn("failed to remove ready marker", "marker", marker, "error", err)
+		}
+	}
+}
+
+// uniquePath - путь в dir для файла, не затирающий уже лежащий там файл с тем же именем
+func uniquePath(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	return filepath.Join(dir, time.Now().Format("150405.000000")+"_"+name)
+}
+
+// moveFile - rename, а если папки на разных томах - копирование с удалением
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst, func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} }); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// gzipFile - сжимает src в dst и удаляет src
+func gzipFile(src, dst string) error {
+	if err := copyFile(src, dst, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile - копирует src в dst через обертку над writer (например gzip)
+func copyFile(src, dst string, wrap func(io.Writer) io.WriteCloser) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	w := wrap(out)
+	if _, err := io.Copy(w, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return out.Close()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
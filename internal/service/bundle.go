@@ -0,0 +1,121 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/parser"
+)
+
+// isZipFile - zip архив с выгрузками, каждый файл внутри загружается отдельно
+func isZipFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".zip")
+}
+
+// isCompressed - файл уже сжат, в архив его переносим как есть
+func isCompressed(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, ".gz") || isZipFile(lower)
+}
+
+// archiveEntryName - имя файла из zip в processed_files и source_file: <архив>/<путь внутри>.
+// Путь не чистится: после checkZipEntries в нем нет "..", и имя всегда остается внутри архива
+func archiveEntryName(archiveName, entryName string) string {
+	return archiveName + "/" + entryName
+}
+
+// checkZipEntries - имена файлов архива должны быть относительными путями без "." и "..",
+// обратных слешей и повторов. Иначе файл из архива получил бы имя другого файла
+// (bundle.zip/../data.tsv) и перезаписал его строку в processed_files и сообщения,
+// поэтому такой архив отклоняется целиком, ничего не загрузив
+func checkZipEntries(files []*zip.File) error {
+	seen := make(map[string]bool, len(files))
+	for _, entry := range files {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		if !fs.ValidPath(entry.Name) || strings.Contains(entry.Name, `\`) {
+			return &parser.ParseError{Err: fmt.Errorf("unsafe entry name %q", entry.Name)}
+		}
+		if seen[entry.Name] {
+			return &parser.ParseError{Err: fmt.Errorf("duplicate entry name %q", entry.Name)}
+		}
+		seen[entry.Name] = true
+	}
+	return nil
+}
+
+// ingestZip - загружает каждый файл поддерживаемого формата из zip отдельно со ссылкой на архив.
+// Первая же ошибка валит весь архив: при повторе уже загруженные файлы
+// перезапишутся без дублей, так как загрузка файла идемпотентна
+func (s *Scanner) ingestZip(ctx context.Context, filePath, fileName string, devices map[string]bool) error {
+	archive, err := zip.OpenReader(filePath)
+	if errors.Is(err, zip.ErrFormat) {
+		// это не zip или он обрезан - повтор не поможет
+		return fmt.Errorf("open zip: %w", &parser.ParseError{Err: err})
+	}
+	if err != nil {
+		return fmt.Errorf("open zip: %w", err)
+	}
+	defer archive.Close()
+
+	if err := checkZipEntries(archive.File); err != nil {
+		return fmt.Errorf("check zip: %w", err)
+	}
+
+	ingested := 0
+	for _, entry := range archive.File {
+		// внутри архива сжатые файлы не поддерживаем
+		if entry.FileInfo().IsDir() || !parser.Supported(entry.Name) || isCompressed(entry.Name) {
+			continue
+		}
+
+		entryName := archiveEntryName(fileName, entry.Name)
+		if err := s.ingestZipEntry(ctx, entry, entryName, fileName, devices); err != nil {
+			if uErr := s.repo.UpdateFileStatus(ctx, entryName, models.StatusError, err.Error()); uErr != nil {
+				s.logger.Error("failed to mark archive entry as error",
+					"file", entryName,
+					"error", uErr)
+			}
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		ingested++
+	}
+
+	if ingested == 0 {
+		return &parser.ParseError{Err: errors.New("no supported files found in archive")}
+	}
+
+	s.logger.Info("archive ingested", "file", fileName, "files", ingested)
+
+	// сам архив помечаем отдельно: его файлы уже processed, но у архива своей загрузки нет
+	if err := s.repo.UpdateFileStatus(ctx, fileName, models.StatusProcessed, ""); err != nil {
+		return fmt.Errorf("mark archive processed: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Scanner) ingestZipEntry(ctx context.Context, entry *zip.File, entryName, archiveName string, devices map[string]bool) error {
+	if err := s.repo.RegisterArchiveEntry(ctx, entryName, archiveName); err != nil {
+		return err
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("open zip entry: %w", err)
+	}
+	defer rc.Close()
+
+	stream, err := parser.NewStream(rc, entryName, s.parserOptions(entryName))
+	if err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+
+	return s.ingestStream(ctx, entryName, stream, devices)
+}
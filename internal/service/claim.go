@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+)
+
+// claimResult - чем закончилась попытка забрать файл в работу
+type claimResult int
+
+const (
+	claimed      claimResult = iota // файл наш
+	claimBusy                       // файл держит другой воркер или он ждет паузы между попытками, попробовать позже
+	claimSkipped                    // загружать файл не нужно
+)
+
+// claim - забирает файл в работу через БД: при нескольких репликах на общей папке input
+// задание на файл может попасть к любой из них, но обработает его только та, что его забрала.
+// Возвращает хеш содержимого забранного файла
+func (s *Scanner) claim(ctx context.Context, id int, filePath, fileName, workerID string) (string, claimResult, error) {
+	hash, err := hashFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// другая реплика уже обработала файл и убрала его из input
+		s.logger.Info("file is gone from input, skipping",
+			"worker_id", id,
+			"file", fileName)
+		return "", claimSkipped, nil
+	}
+	if err != nil {
+		return "", claimSkipped, fmt.Errorf("hash file: %w", err)
+	}
+
+	ok, current, err := s.repo.ClaimFile(ctx, fileName, hash, workerID, s.leaseDuration())
+	if err != nil {
+		return "", claimSkipped, err
+	}
+	if ok {
+		return hash, claimed, nil
+	}
+
+	switch {
+	case current == nil:
+		s.logger.Info("file is being claimed by another replica, will retry",
+			"worker_id", id,
+			"file", fileName)
+		return "", claimBusy, nil
+	case current.Status == models.StatusProcessing:
+		s.logger.Info("file is processed by another worker, will retry",
+			"worker_id", id,
+			"file", fileName,
+			"owner", current.WorkerID)
+		return "", claimBusy, nil
+	case current.Status == models.StatusError:
+		s.logger.Info("file waits for next retry",
+			"worker_id", id,
+			"file", fileName,
+			"next_retry_at", current.NextRetryAt)
+		return "", claimBusy, nil
+	case current.Status == models.StatusFailed:
+		// то же содержимое уже исчерпало попытки - файл ждет reprocess и остается где лежит
+		s.logger.Warn("file failed all attempts, skipping until reprocess",
+			"worker_id", id,
+			"file", fileName)
+		return "", claimSkipped, nil
+	default:
+		// то же содержимое уже загружено под этим именем - файл в input больше не нужен
+		s.logger.Info("file content already processed, skipping",
+			"worker_id", id,
+			"file", fileName,
+			"status", current.Status)
+
+		if _, err := os.Stat(filePath); err == nil {
+			if err := s.archive(filePath, fileName); err != nil {
+				s.logger.Error("failed to archive file",
+					"worker_id", id,
+					"file", fileName,
+					"error", err)
+			}
+		}
+	}
+
+	return "", claimSkipped, nil
+}
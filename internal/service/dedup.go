@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+)
+
+// hashEntry - закешированный хеш файла, пересчитывается только при смене размера или mtime
+type hashEntry struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// deduplicate - сверяет содержимое файла с уже загруженными.
+// Возвращает true, если файл загружать не нужно: такой же файл уже обработан под этим или другим именем.
+// Иначе запоминает хеш и, если под этим именем раньше было другое содержимое, заводит новую ревизию.
+// С force (повторная загрузка из API) дубликаты не ищутся
+func (s *Scanner) deduplicate(ctx context.Context, id int, filePath, fileName, hash string, force bool) (bool, error) {
+	var (
+		original *models.ProcessedFile
+		err      error
+	)
+	if !force {
+		original, err = s.repo.GetProcessedFileByHash(ctx, hash)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if original != nil {
+		if original.FileName == fileName {
+			s.logger.Info("file content already processed, skipping",
+				"worker_id", id,
+				"file", fileName)
+		} else {
+			if err := s.repo.MarkFileDuplicate(ctx, fileName, hash, original.FileName); err != nil {
+				return false, err
+			}
+			s.logger.Warn("file is a duplicate of already processed file, skipping",
+				"worker_id", id,
+				"file", fileName,
+				"duplicate_of", original.FileName)
+		}
+
+		if err := s.archive(filePath, fileName); err != nil {
+			s.logger.Error("failed to archive file",
+				"worker_id", id,
+				"file", fileName,
+				"error", err)
+		}
+		return true, nil
+	}
+
+	revision, err := s.repo.SetFileHash(ctx, fileName, hash)
+	if err != nil {
+		return false, err
+	}
+
+	if revision > 1 {
+		s.logger.Info("new revision of file",
+			"worker_id", id,
+			"file", fileName,
+			"revision", revision)
+	}
+
+	return false, nil
+}
+
+// contentChanged - отличается ли содержимое файла в input от уже загруженного под этим именем.
+// Для старых записей без хеша считаем, что не отличается
+func (s *Scanner) contentChanged(fileName, storedHash string) bool {
+	if storedHash == "" {
+		return false
+	}
+
+	path := filepath.Join(s.cfg.Application.Input, fileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	entry, ok := s.hashes[fileName]
+	s.mu.Unlock()
+
+	if !ok || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		hash, err := hashFile(path)
+		if err != nil {
+			s.logger.Error("failed to hash file", "file", fileName, "error", err)
+			return false
+		}
+
+		entry = hashEntry{size: info.Size(), modTime: info.ModTime(), hash: hash}
+		s.mu.Lock()
+		s.hashes[fileName] = entry
+		s.mu.Unlock()
+	}
+
+	return entry.hash != storedHash
+}
+
+// hashFile - SHA-256 содержимого файла в hex
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/parser"
+	"github.com/alonsoF100/reporting-service/internal/repository/postgres"
+)
+
+// errorCategory - permanent, если файл упадет и при повторе: битое содержимое или данные,
+// которые отвергла БД. Все остальное (сбои БД, ввода-вывода) - transient
+func errorCategory(err error) string {
+	var (
+		parseErr *parser.ParseError
+		dataErr  *postgres.DataError
+	)
+	if errors.As(err, &parseErr) || errors.As(err, &dataErr) {
+		return models.ErrorPermanent
+	}
+	return models.ErrorTransient
+}
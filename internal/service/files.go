@@ -0,0 +1,282 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/repository/postgres"
+)
+
+// FileService - входные файлы для API: загрузка, статус обработки, отклоненные строки
+type FileService struct {
+	repo     *postgres.Repository
+	scanner  *Scanner
+	inputDir string
+	logger   *slog.Logger
+}
+
+func NewFileService(repo *postgres.Repository, scanner *Scanner, inputDir string) *FileService {
+	return &FileService{
+		repo:     repo,
+		scanner:  scanner,
+		inputDir: inputDir,
+		logger:   slog.With("component", "files"),
+	}
+}
+
+// UploadFile - сохраняет загруженный файл в input, регистрирует его со статусом queued
+// и сразу ставит в очередь сканера. Пока файл пишется, он лежит под временным именем,
+// чтобы вотчер и сканер не взяли его недописанным
+func (s *FileService) UploadFile(ctx context.Context, fileName string, body io.Reader) (*models.ProcessedFile, error) {
+	const op = "service.UploadFile"
+
+	fileName = filepath.Base(filepath.Clean(fileName))
+	if fileName == "." || strings.HasPrefix(fileName, ".") || !isInputFile(fileName) {
+		return nil, fmt.Errorf("%s: %w: %q", op, models.ErrUnsupportedFile, fileName)
+	}
+
+	// быстрый отказ до приема тела; окончательно имя занимает os.Link ниже
+	target := filepath.Join(s.inputDir, fileName)
+	if _, err := os.Stat(target); err == nil {
+		return nil, fmt.Errorf("%s: %w: %s", op, models.ErrFileExists, fileName)
+	}
+
+	// временный файл с точкой в начале и без входного расширения сканер не видит
+	tmp, err := os.CreateTemp(s.inputDir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: write upload: %w", op, err)
+	}
+
+	// в отличие от rename, link не перезаписывает существующий файл: из двух одновременных
+	// загрузок с одним именем вторая получит ErrFileExists, а не затрет первую
+	if err := os.Link(tmp.Name(), target); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("%s: %w: %s", op, models.ErrFileExists, fileName)
+		}
+		return nil, fmt.Errorf("%s: move upload to input: %w", op, err)
+	}
+
+	if err := s.repo.UpdateFileStatus(ctx, fileName, models.StatusQueued, ""); err != nil {
+		// без записи в processed_files загрузка не состоялась, имя освобождаем
+		if rmErr := os.Remove(target); rmErr != nil {
+			s.logger.Error("failed to remove unregistered upload", "file", fileName, "error", rmErr)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.logger.Info("file uploaded", "file", fileName, "size", size)
+
+	// если поставить задание не вышло, файл заберет следующий скан - статус queued он тоже берет
+	if err := s.scanner.enqueueJob(ctx, fileName, models.PriorityHigh, false); err != nil {
+		s.logger.Warn("upload not queued immediately, left for next scan", "file", fileName, "error", err)
+	}
+
+	return s.repo.GetProcessedFile(ctx, fileName)
+}
+
+// ListFiles - файлы с фильтром по статусу (пустой - все) и пагинацией
+func (s *FileService) ListFiles(ctx context.Context, status string, page, limit int) ([]models.ProcessedFile, int, error) {
+	switch status {
+	case "", models.StatusQueued, models.StatusProcessing, models.StatusProcessed,
+		models.StatusError, models.StatusFailed, models.StatusDuplicate:
+	default:
+		return nil, 0, fmt.Errorf("service.ListFiles: %w: %q", models.ErrUnknownStatus, status)
+	}
+
+	return s.repo.ListProcessedFiles(ctx, status, page, limit)
+}
+
+// GetFile - статус обработки файла, попытки, ошибка и сводка по загруженным сообщениям
+func (s *FileService) GetFile(ctx context.Context, fileName string) (*models.FileDetails, error) {
+	file, err := s.repo.GetFileDetails(ctx, fileName)
+	if err != nil && !errors.Is(err, models.ErrFileNotFound) {
+		return nil, fmt.Errorf("service.GetFile: %w", err)
+	}
+	return file, err
+}
+
+// GetFileByID - то же, что GetFile, по id записи в processed_files: его возвращают
+// загрузка и reprocess, и он не меняется при повторной обработке файла
+func (s *FileService) GetFileByID(ctx context.Context, id int64) (*models.FileDetails, error) {
+	file, err := s.repo.GetProcessedFileByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, models.ErrFileNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("service.GetFileByID: %w", err)
+	}
+
+	return s.GetFile(ctx, file.FileName)
+}
+
+// ReprocessFile - принудительно загружает файл заново, даже если он уже обработан или такое
+// содержимое есть в БД. Файл, уже ушедший из input, возвращается туда из карантина или архива.
+// Для файла из zip перезагружается весь архив
+func (s *FileService) ReprocessFile(ctx context.Context, fileName string) (*models.ProcessedFile, error) {
+	const op = "service.ReprocessFile"
+
+	file, err := s.repo.GetProcessedFile(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.ArchivePath != "" {
+		s.logger.Info("reprocessing whole archive of entry", "file", fileName, "archive", file.ArchivePath)
+		return s.ReprocessFile(ctx, file.ArchivePath)
+	}
+
+	// файл в работе у воркера этой или другой реплики
+	if file.Status == models.StatusProcessing &&
+		file.LeaseExpiresAt != nil && file.LeaseExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%s: %w: %s", op, models.ErrFileBusy, fileName)
+	}
+
+	if err := s.restoreInput(fileName); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.repo.RequeueFile(ctx, fileName); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.logger.Info("file requeued for reprocessing", "file", fileName, "previous_status", file.Status)
+
+	if err := s.scanner.enqueueJob(ctx, fileName, models.PriorityHigh, true); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.repo.GetProcessedFile(ctx, fileName)
+}
+
+// restoreInput - убеждается, что файл лежит в input: если его там нет, возвращает
+// из карантина или из самой свежей папки архива (сжатый при архивации распаковывается)
+func (s *FileService) restoreInput(fileName string) error {
+	target := filepath.Join(s.inputDir, fileName)
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+
+	cfg := s.scanner.cfg.Application
+
+	if cfg.Quarantine != "" {
+		source := filepath.Join(cfg.Quarantine, fileName)
+		if _, err := os.Stat(source); err == nil {
+			if err := moveFile(source, target); err != nil {
+				return fmt.Errorf("restore from quarantine: %w", err)
+			}
+			// отчет об ошибке относится к прошлой попытке
+			_ = os.Remove(source + ".error.json")
+
+			s.logger.Info("file restored from quarantine", "file", fileName)
+			return nil
+		}
+	}
+
+	if cfg.Archive != "" {
+		source, gzipped := latestArchived(cfg.Archive, fileName)
+		if source != "" {
+			if err := s.copyToInput(source, fileName, gzipped); err != nil {
+				return fmt.Errorf("restore from archive: %w", err)
+			}
+
+			s.logger.Info("file restored from archive", "file", fileName, "archived", source)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", models.ErrFileGone, fileName)
+}
+
+// latestArchived - путь к файлу в самой свежей папке архива, gzipped - сжат ли он при архивации
+func latestArchived(archiveDir, fileName string) (string, bool) {
+	var (
+		latest  string
+		gzipped bool
+	)
+
+	dirs, _ := filepath.Glob(filepath.Join(archiveDir, "*"))
+	// папки архива названы датами, по имени они идут по порядку
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		if path := filepath.Join(dir, fileName); fileExists(path) {
+			latest, gzipped = path, false
+		}
+		if path := filepath.Join(dir, fileName+".gz"); !isCompressed(fileName) && fileExists(path) {
+			latest, gzipped = path, true
+		}
+	}
+
+	return latest, gzipped
+}
+
+// copyToInput - копирует файл из архива в input под временным именем и переименовывает,
+// чтобы сканер не взял его недописанным. Архив остается как был
+func (s *FileService) copyToInput(source, fileName string, gzipped bool) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if gzipped {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tmp, err := os.CreateTemp(s.inputDir, ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.inputDir, fileName))
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// GetFileRejections - строки файла, отклоненные при загрузке: страница сохраненных строк,
+// сколько их сохранено и сколько отклонено всего
+func (s *FileService) GetFileRejections(
+	ctx context.Context,
+	fileName string,
+	page, limit int,
+) ([]models.RejectedRow, int, int, error) {
+	return s.repo.GetRejectedRows(ctx, fileName, page, limit)
+}
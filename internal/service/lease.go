@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+)
+
+// defaultLeaseDuration - аренда файла воркером, если lease_duration не задан
+const defaultLeaseDuration = time.Minute
+
+// instanceID - имя экземпляра сервиса для worker_id: хост и pid
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// workerID - идентификатор воркера в processed_files.worker_id
+func (s *Scanner) workerID(id int) string {
+	return fmt.Sprintf("%s/%d", s.instance, id)
+}
+
+func (s *Scanner) leaseDuration() time.Duration {
+	if s.cfg.Application.LeaseDuration > 0 {
+		return s.cfg.Application.LeaseDuration
+	}
+	return defaultLeaseDuration
+}
+
+// defaultPollInterval - как часто свободный воркер заглядывает в jobs, если poll_interval не задан
+const defaultPollInterval = time.Second
+
+func (s *Scanner) pollInterval() time.Duration {
+	if s.cfg.Application.PollInterval > 0 {
+		return s.cfg.Application.PollInterval
+	}
+	return defaultPollInterval
+}
+
+// keepAlive - пока воркер занят, раз в треть аренды продлевает ее в БД через extend
+// (аренду файла или видимость задания). Возвращает функцию, которая останавливает продление
+func (s *Scanner) keepAlive(ctx context.Context, fileName, workerID string, extend func(context.Context) error) func() {
+	lease := s.leaseDuration()
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := extend(ctx)
+				switch {
+				case errors.Is(err, models.ErrLeaseLost):
+					// между попытками статус может быть уже не processing, это не повод паниковать
+					s.logger.Debug("lease is not held, heartbeat skipped", "file", fileName, "worker", workerID)
+				case err != nil && ctx.Err() == nil:
+					s.logger.Warn("failed to extend lease", "file", fileName, "worker", workerID, "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// reap - возвращает в очередь файлы, чья аренда истекла: воркер, который их держал, упал
+// вместе с сервисом и так и не сменил статус processing
+func (s *Scanner) reap(ctx context.Context) {
+	files, err := s.repo.ReapExpiredLeases(ctx, s.leaseDuration())
+	if err != nil {
+		s.logger.Error("failed to reap expired leases", "error", err)
+		return
+	}
+
+	for _, fileName := range files {
+		s.logger.Warn("file stuck in processing returned to queue", "file", fileName)
+
+		// файла уже может не быть в input - тогда его вернет только reprocess из API
+		if _, err := os.Stat(filepath.Join(s.cfg.Application.Input, fileName)); err != nil {
+			s.logger.Warn("reaped file is not in input", "file", fileName, "error", err)
+			continue
+		}
+		s.enqueue(ctx, fileName)
+	}
+}
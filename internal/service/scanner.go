@@ -6,12 +6,13 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/alonsoF100/reporting-service/internal/config"
 	"github.com/alonsoF100/reporting-service/internal/models"
 	"github.com/alonsoF100/reporting-service/internal/parser"
-	"github.com/jung-kurt/gofpdf"
+	"github.com/alonsoF100/reporting-service/internal/report"
 )
 
 type Repository interface {
@@ -24,51 +25,121 @@ type Repository interface {
 	// Обновляет статус файла и сообщение об ошибке
 	UpdateFileStatus(ctx context.Context, fileName string, status, errorMsg string) error
 
-	// Сохранить сообщения из файла
-	SaveMessages(ctx context.Context, messages []models.DeviceMessage) error
+	// Найти обработанный файл с тем же содержимым
+	GetProcessedFileByHash(ctx context.Context, contentHash string) (*models.ProcessedFile, error)
+
+	// Запомнить хеш содержимого файла, возвращает номер ревизии
+	SetFileHash(ctx context.Context, fileName, contentHash string) (int, error)
+
+	// Пометить файл дубликатом ранее загруженного
+	MarkFileDuplicate(ctx context.Context, fileName, contentHash, duplicateOf string) error
+
+	// Забрать файл в работу воркеру, если его не держит другая реплика и его нужно загружать.
+	// Возвращает, забран ли файл, и текущую запись о нем
+	ClaimFile(ctx context.Context, fileName, contentHash, workerID string, lease time.Duration) (bool, *models.ProcessedFile, error)
+
+	// Поставить файлу статус processing, увеличить счетчик попыток и выдать воркеру аренду на lease,
+	// возвращает номер попытки
+	StartFileAttempt(ctx context.Context, fileName, workerID string, lease time.Duration) (int, error)
+
+	// Откатить попытку, прерванную остановкой сервиса: счетчик не растет, файл снова queued
+	AbortFileAttempt(ctx context.Context, fileName, workerID string) error
+
+	// Пометить попытку упавшей: статус error, следующая попытка не раньше retryAt
+	ScheduleFileRetry(ctx context.Context, fileName, errorMsg string, retryAt time.Time) error
+
+	// Поставить файлу терминальный статус failed с категорией ошибки (permanent/transient)
+	MarkFileFailed(ctx context.Context, fileName, category, errorMsg string) error
+
+	// Продлить аренду файла воркером
+	HeartbeatFile(ctx context.Context, fileName, workerID string, lease time.Duration) error
+
+	// Вернуть в queued файлы с истекшей арендой, возвращает их имена
+	ReapExpiredLeases(ctx context.Context, lease time.Duration) ([]string, error)
+
+	// Завести запись для TSV из zip архива
+	RegisterArchiveEntry(ctx context.Context, fileName, archivePath string) error
+
+	// Атомарно сохранить сообщения файла вместо ранее загруженных из него и пометить файл обработанным.
+	// Сообщения забираются из next пачками, отклоненные строки - из rejected после них.
+	// Возвращает число сохраненных сообщений
+	IngestFile(ctx context.Context, fileName string, next models.NextBatch, rejected func() ([]models.RejectedRow, int)) (int64, error)
 
 	// Получить все сообщения устройства
 	GetAllMessagesByUnitGUID(ctx context.Context, unitGUID string) ([]models.DeviceMessage, error)
+
+	// Очередь jobs: поставить файл, выдать воркеру задание со скрытием на visibility,
+	// продлить его, завершить или вернуть в очередь до runAt
+	EnqueueJob(ctx context.Context, fileName string, priority int, force bool) error
+	DequeueJob(ctx context.Context, workerID string, visibility time.Duration) (*models.Job, error)
+	ExtendJob(ctx context.Context, id int64, workerID string, visibility time.Duration) error
+	CompleteJob(ctx context.Context, id int64, workerID string) error
+	ReleaseJob(ctx context.Context, id int64, workerID string, runAt time.Time, reason string) error
 }
 
 type Scanner struct {
-	cfg    *config.Config
-	repo   Repository
-	queue  chan string
-	logger *slog.Logger
+	cfg       *config.Config
+	repo      Repository
+	renderers []report.Renderer
+	wake      chan struct{} // будит воркеров, когда эта реплика ставит задание
+	logger    *slog.Logger
+	instance  string // хост и pid, из него собирается worker_id
+
+	// файлы, которые еще дописываются (см. stability.go)
+	mu       sync.Mutex
+	observed map[string]fileState
+	hashes   map[string]hashEntry
 }
 
-func NewScanner(cfg *config.Config, repo Repository) *Scanner {
-	queue := make(chan string, cfg.Application.QueueSize)
-
+func NewScanner(cfg *config.Config, repo Repository, renderers []report.Renderer) *Scanner {
 	return &Scanner{
-		cfg:    cfg,
-		repo:   repo,
-		queue:  queue,
-		logger: slog.With("component", "scanner"),
+		cfg:       cfg,
+		repo:      repo,
+		renderers: renderers,
+		wake:      make(chan struct{}, max(cfg.Application.Workers, 1)),
+		logger:    slog.With("component", "scanner"),
+		instance:  instanceID(),
+		observed:  make(map[string]fileState),
+		hashes:    make(map[string]hashEntry),
 	}
 }
 
-// Start запускает периодическое сканирование
+// Start запускает периодическое сканирование, а при включенном watch еще и вотчер папки.
+// В режиме watch периодический скан остается как сверка на случай пропущенных событий
 func (s *Scanner) Start(ctx context.Context) {
 	for i := 0; i < s.cfg.Application.Workers; i++ {
 		go s.Worker(ctx, i)
 	}
 	s.logger.Info("workers started", "count", s.cfg.Application.Workers)
 
+	if s.cfg.Application.Watch {
+		go func() {
+			if err := s.Watch(ctx); err != nil {
+				s.logger.Error("watcher stopped, only periodic scan is active", "error", err)
+			}
+		}()
+	}
+
 	ticker := time.NewTicker(s.cfg.Application.Period)
 	defer ticker.Stop()
 
+	// файлы, брошенные упавшим экземпляром, возвращаются в очередь при старте и потом по таймеру
+	reapTicker := time.NewTicker(s.leaseDuration())
+	defer reapTicker.Stop()
+
 	s.logger.Info("scanner started",
 		"interval", s.cfg.Application.Period,
-		"queue_size", s.cfg.Application.QueueSize)
+		"instance", s.instance)
 
+	s.reap(ctx)
 	s.Scan(ctx)
 
 	for {
 		select {
 		case <-ticker.C:
 			s.Scan(ctx)
+		case <-reapTicker.C:
+			s.reap(ctx)
 		case <-ctx.Done():
 			s.logger.Info("scanner stopped")
 			return
@@ -86,9 +157,9 @@ func (s *Scanner) Scan(ctx context.Context) {
 		return
 	}
 
-	processedMap := make(map[string]string)
+	processedMap := make(map[string]models.ProcessedFile)
 	for _, f := range dbFiles {
-		processedMap[f.FileName] = f.Status
+		processedMap[f.FileName] = f
 	}
 
 	dirEntries, err := os.ReadDir(s.cfg.Application.Input)
@@ -99,12 +170,12 @@ func (s *Scanner) Scan(ctx context.Context) {
 
 	newFiles := []string{}
 	for _, entry := range dirEntries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".tsv" {
+		if entry.IsDir() || !isInputFile(entry.Name()) {
 			continue
 		}
 
 		fileName := entry.Name()
-		status, exists := processedMap[fileName]
+		file, exists := processedMap[fileName]
 
 		if !exists {
 			newFiles = append(newFiles, fileName)
@@ -112,133 +183,317 @@ func (s *Scanner) Scan(ctx context.Context) {
 			continue
 		}
 
-		if status == models.StatusError {
+		switch file.Status {
+		case models.StatusQueued:
+			// загружен через API, но в очередь сразу не попал
 			newFiles = append(newFiles, fileName)
-			s.logger.Info("retry file with error", "file", fileName)
+			s.logger.Info("queued upload found", "file", fileName)
+		case models.StatusError:
+			// до next_retry_at файл ждет своей паузы, failed не повторяется вовсе
+			if file.NextRetryAt != nil && file.NextRetryAt.After(time.Now()) {
+				s.logger.Debug("file waits for retry", "file", fileName, "next_retry_at", file.NextRetryAt)
+				continue
+			}
+			newFiles = append(newFiles, fileName)
+			s.logger.Info("retry file with error", "file", fileName, "attempts", file.Attempts)
+		case models.StatusProcessed, models.StatusDuplicate, models.StatusFailed:
+			// под тем же именем лежит исправленный файл - грузим как новую ревизию
+			if s.contentChanged(fileName, file.ContentHash) {
+				newFiles = append(newFiles, fileName)
+				s.logger.Info("file content changed, new revision", "file", fileName)
+			}
 		}
 	}
 
 	for _, fileName := range newFiles {
-		fullPath := filepath.Join(s.cfg.Application.Input, fileName)
+		s.admit(ctx, fileName)
+	}
 
-		select {
-		case s.queue <- fullPath:
-			s.logger.Info("file added to queue", "file", fileName)
-		default:
-			s.logger.Error("queue is full, skipping file",
-				"file", fileName,
-				"queue_size", s.cfg.Application.QueueSize)
-		}
+	s.logger.Info("scan completed", "new_files", len(newFiles))
+}
+
+// enqueue - ставит файл из input папки в очередь jobs с обычным приоритетом
+func (s *Scanner) enqueue(ctx context.Context, fileName string) bool {
+	if err := s.enqueueJob(ctx, fileName, models.PriorityNormal, false); err != nil {
+		s.logger.Error("failed to enqueue file", "file", fileName, "error", err)
+		return false
 	}
+	return true
+}
+
+// enqueueJob - ставит файл в очередь jobs и будит свободного воркера.
+// Задание на файл одно, так что повторная постановка его не дублирует.
+// С force файл загрузится заново без проверки на дубликат (reprocess из API)
+func (s *Scanner) enqueueJob(ctx context.Context, fileName string, priority int, force bool) error {
+	if err := s.repo.EnqueueJob(ctx, fileName, priority, force); err != nil {
+		return err
+	}
+
+	s.logger.Info("file added to queue", "file", fileName, "priority", priority, "force", force)
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
 
-	s.logger.Info("scan completed",
-		"new_files", len(newFiles),
-		"queue_size", len(s.queue))
+// isInputFile - подходит ли файл для обработки по расширению: формат из реестра парсеров
+// (TSV, CSV, JSON Lines, XLSX), он же сжатый .gz, или zip с такими файлами внутри
+func isInputFile(name string) bool {
+	return parser.Supported(name) || isZipFile(name)
 }
 
-// Worker обрабатывает файлы из очереди
+// Worker забирает задания из очереди jobs. Пока задание в работе, оно скрыто от других воркеров
+// и реплик; если воркер упал, задание снова станет видно через lease_duration
 func (s *Scanner) Worker(ctx context.Context, id int) {
 	s.logger.Info("worker started", "worker_id", id)
 
-	for {
-		select {
-		case filePath := <-s.queue:
-			fileName := filepath.Base(filePath)
+	workerID := s.workerID(id)
 
-			retryCount := 0
-			maxRetries := s.cfg.Application.MaxRetries
+	for ctx.Err() == nil {
+		job, err := s.repo.DequeueJob(ctx, workerID, s.leaseDuration())
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("failed to dequeue job", "worker_id", id, "error", err)
+		}
 
-			err := s.repo.UpdateFileStatus(ctx, fileName, models.StatusProcessing, "")
-			if err != nil {
-				s.logger.Error("failed to mark file as processing",
-					"worker_id", id,
-					"file", fileName,
-					"error", err)
+		if job == nil {
+			select {
+			case <-s.wake:
+			case <-time.After(s.pollInterval()):
+			case <-ctx.Done():
 			}
+			continue
+		}
 
-			// обрабатываем файл + механизм попыток
-			for retryCount < maxRetries {
-				err = s.processFile(ctx, filePath, fileName)
-				if err == nil {
-					s.repo.UpdateFileStatus(ctx, fileName, models.StatusProcessed, "")
-					s.logger.Info("file processed successfully",
-						"worker_id", id,
-						"file", fileName,
-						"attempt", retryCount+1)
-					break
-				}
-
-				retryCount++
-				s.logger.Error("failed to process file",
-					"worker_id", id,
-					"file", fileName,
-					"attempt", retryCount,
-					"max_retries", maxRetries,
-					"error", err)
+		s.runJob(ctx, id, job)
+	}
 
-				if retryCount < maxRetries {
-					waitTime := time.Duration(retryCount*2) * time.Second
-					s.logger.Info("retrying file",
-						"worker_id", id,
-						"file", fileName,
-						"wait_time", waitTime,
-						"next_attempt", retryCount+1)
-					time.Sleep(waitTime)
-				}
-			}
+	s.logger.Info("worker stopped", "worker_id", id)
+}
 
-			// Если не сумели за n попыток, то помечаем ошибкой
-			if retryCount == maxRetries && err != nil {
-				s.repo.UpdateFileStatus(ctx, fileName, models.StatusError, err.Error())
-				s.logger.Error("file failed after all retries",
-					"worker_id", id,
-					"file", fileName,
-					"max_retries", maxRetries,
-					"error", err)
-			}
+// runJob - обрабатывает файл задания и убирает задание из очереди. Если файл держит другой воркер,
+// попытка упала или сервис останавливается, задание возвращается в очередь и не теряется
+func (s *Scanner) runJob(ctx context.Context, id int, job *models.Job) {
+	workerID := s.workerID(id)
+	lease := s.leaseDuration()
+
+	stopJob := s.keepAlive(ctx, job.FileName, workerID, func(ctx context.Context) error {
+		return s.repo.ExtendJob(ctx, job.ID, workerID, lease)
+	})
+
+	filePath := filepath.Join(s.cfg.Application.Input, job.FileName)
+	retry := s.processQueued(ctx, id, filePath, job.FileName, job.Force)
+	stopJob()
+
+	// контекст уже может быть отменен, а задание все равно нужно отпустить
+	dbCtx := context.WithoutCancel(ctx)
+
+	var err error
+	switch {
+	case ctx.Err() != nil:
+		err = s.repo.ReleaseJob(dbCtx, job.ID, workerID, time.Now(), "worker stopped")
+	case retry != nil && retry.failed && s.cfg.Retry.Exhausted(job.Attempts):
+		s.failJob(dbCtx, id, job, retry.reason)
+		err = s.repo.CompleteJob(dbCtx, job.ID, workerID)
+	case retry != nil && retry.failed:
+		// до обработки файла не дошло (нет доступа к файлу, ошибка БД): такие сбои повторяются
+		// по той же политике, что и упавшие попытки, только счет идет по выдачам задания
+		err = s.repo.ReleaseJob(dbCtx, job.ID, workerID, time.Now().Add(s.cfg.Retry.Delay(job.Attempts)), retry.reason)
+	case retry != nil:
+		// воркер не ждет паузу сам, а берет следующие задания
+		err = s.repo.ReleaseJob(dbCtx, job.ID, workerID, retry.at, retry.reason)
+	default:
+		err = s.repo.CompleteJob(dbCtx, job.ID, workerID)
+	}
+	if err != nil {
+		s.logger.Error("failed to finish job",
+			"worker_id", id,
+			"job_id", job.ID,
+			"file", job.FileName,
+			"error", err)
+	}
+}
 
-		case <-ctx.Done():
-			s.logger.Info("worker stopped", "worker_id", id)
-			return
-		}
+// retryJob - когда и почему задание нужно вернуть в очередь.
+// failed - задание упало до попытки обработать файл, когда повторить, решает runJob
+type retryJob struct {
+	at     time.Time
+	reason string
+	failed bool
+}
+
+// failJob - задание исчерпало попытки, так ни разу и не дойдя до обработки файла:
+// файл помечается failed, иначе задание возвращалось бы в очередь бесконечно
+func (s *Scanner) failJob(ctx context.Context, id int, job *models.Job, reason string) {
+	s.logger.Error("job failed before processing, no more retries",
+		"worker_id", id,
+		"job_id", job.ID,
+		"file", job.FileName,
+		"attempts", job.Attempts,
+		"error", reason)
+
+	if err := s.repo.MarkFileFailed(ctx, job.FileName, models.ErrorTransient, reason); err != nil {
+		s.logger.Error("failed to mark file as failed",
+			"worker_id", id,
+			"file", job.FileName,
+			"error", err)
 	}
 }
 
-// processFile - основная логика обработки файла
-func (s *Scanner) processFile(ctx context.Context, filePath, fileName string) error {
-	s.logger.Info("processing file", "file", fileName)
+// processQueued - делает одну попытку обработать файл из очереди.
+// Возвращает, когда повторить задание: файл держит другой воркер, до обработки не дошло
+// из-за ошибки или попытка упала на временном сбое и попытки еще не исчерпаны.
+// nil - задание выполнено
+func (s *Scanner) processQueued(ctx context.Context, id int, filePath, fileName string, force bool) *retryJob {
+	workerID := s.workerID(id)
+	lease := s.leaseDuration()
 
-	// парсим файл
-	parseResult, err := parser.ParseTSV(filePath)
+	hash, claim, err := s.claim(ctx, id, filePath, fileName, workerID)
 	if err != nil {
-		return fmt.Errorf("parse error: %w", err)
+		s.logger.Error("failed to claim file",
+			"worker_id", id,
+			"file", fileName,
+			"error", err)
+		return &retryJob{reason: err.Error(), failed: true}
+	}
+	switch claim {
+	case claimBusy:
+		// файл в работе у другого воркера: проверим снова, когда истечет его аренда
+		return &retryJob{at: time.Now().Add(lease), reason: "file is held by another worker"}
+	case claimSkipped:
+		return nil
+	}
+
+	// пока файл в работе, аренда продлевается - иначе реапер вернет его в очередь
+	stopLease := s.keepAlive(ctx, fileName, workerID, func(ctx context.Context) error {
+		return s.repo.HeartbeatFile(ctx, fileName, workerID, lease)
+	})
+	defer stopLease()
+
+	skip, err := s.deduplicate(ctx, id, filePath, fileName, hash, force)
+	if err != nil {
+		s.logger.Error("failed to check file for duplicates",
+			"worker_id", id,
+			"file", fileName,
+			"error", err)
+		return &retryJob{reason: err.Error(), failed: true}
+	}
+	if skip {
+		return nil
+	}
+
+	// попытки считаются в БД, так что лимит действует и между сканами, и после рестарта
+	attempt, err := s.repo.StartFileAttempt(ctx, fileName, workerID, lease)
+	if err != nil {
+		s.logger.Error("failed to mark file as processing",
+			"worker_id", id,
+			"file", fileName,
+			"error", err)
+		return &retryJob{reason: err.Error(), failed: true}
 	}
 
-	if len(parseResult.Messages) == 0 {
-		return fmt.Errorf("no messages found in file")
+	err = s.processFile(ctx, filePath, fileName)
+	if err == nil {
+		s.logger.Info("file processed successfully",
+			"worker_id", id,
+			"file", fileName,
+			"attempt", attempt)
+
+		if err := s.archive(filePath, fileName); err != nil {
+			s.logger.Error("failed to archive file",
+				"worker_id", id,
+				"file", fileName,
+				"error", err)
+		}
+		return nil
 	}
 
-	s.logger.Info("file parsed successfully",
+	dbCtx := context.WithoutCancel(ctx)
+
+	// остановка сервиса - не вина файла: попытка откатывается и не тратит лимит,
+	// файл сразу возвращается в queued, а задание - в очередь (см. runJob)
+	if ctx.Err() != nil {
+		if aErr := s.repo.AbortFileAttempt(dbCtx, fileName, workerID); aErr != nil {
+			s.logger.Error("failed to abort file attempt",
+				"worker_id", id,
+				"file", fileName,
+				"error", aErr)
+		}
+		return nil
+	}
+
+	policy := s.cfg.Retry
+	category := errorCategory(err)
+
+	s.logger.Error("failed to process file",
+		"worker_id", id,
 		"file", fileName,
-		"messages", len(parseResult.Messages))
+		"attempt", attempt,
+		"max_attempts", policy.MaxAttempts,
+		"category", category,
+		"error", err)
+
+	// битый файл упадет так же и в следующий раз - повторять только временные сбои
+	if category == models.ErrorTransient && !policy.Exhausted(attempt) {
+		retryAt := time.Now().Add(policy.Delay(attempt))
+		if sErr := s.repo.ScheduleFileRetry(dbCtx, fileName, err.Error(), retryAt); sErr != nil {
+			s.logger.Error("failed to schedule retry",
+				"worker_id", id,
+				"file", fileName,
+				"error", sErr)
+		}
 
-	// сейвим в базу сообщения
-	err = s.repo.SaveMessages(ctx, parseResult.Messages)
-	if err != nil {
-		return fmt.Errorf("save messages error: %w", err)
+		s.logger.Info("retrying file",
+			"worker_id", id,
+			"file", fileName,
+			"next_retry_at", retryAt,
+			"next_attempt", attempt+1)
+		return &retryJob{at: retryAt, reason: err.Error()}
 	}
 
-	s.logger.Info("messages saved to DB",
+	// файл больше не берется автоматически, только через reprocess
+	if uErr := s.repo.MarkFileFailed(dbCtx, fileName, category, err.Error()); uErr != nil {
+		s.logger.Error("failed to mark file as failed",
+			"worker_id", id,
+			"file", fileName,
+			"error", uErr)
+	}
+	s.logger.Error("file failed, no more retries",
+		"worker_id", id,
 		"file", fileName,
-		"messages", len(parseResult.Messages))
+		"attempts", attempt,
+		"category", category,
+		"error", err)
+
+	if qErr := s.quarantine(filePath, fileName, attempt, err); qErr != nil {
+		s.logger.Error("failed to quarantine file",
+			"worker_id", id,
+			"file", fileName,
+			"error", qErr)
+	}
 
-	// получаем уникальные девайсы
+	return nil
+}
+
+// processFile - основная логика обработки файла
+func (s *Scanner) processFile(ctx context.Context, filePath, fileName string) error {
+	s.logger.Info("processing file", "file", fileName)
+
+	// по ходу чтения собираем уникальные девайсы, чтобы потом обновить их отчеты
 	uniqueDevices := make(map[string]bool)
-	for _, msg := range parseResult.Messages {
-		uniqueDevices[msg.UnitGUID] = true
+
+	var err error
+	if isZipFile(fileName) {
+		err = s.ingestZip(ctx, filePath, fileName, uniqueDevices)
+	} else {
+		err = s.ingestFile(ctx, filePath, fileName, uniqueDevices)
+	}
+	if err != nil {
+		return err
 	}
 
-	// для каждого девайса уникального генерим пдфку
+	// для каждого девайса уникального генерим отчет
 	for unitGUID := range uniqueDevices {
 		messages, err := s.repo.GetAllMessagesByUnitGUID(ctx, unitGUID)
 		if err != nil {
@@ -248,95 +503,113 @@ func (s *Scanner) processFile(ctx context.Context, filePath, fileName string) er
 			continue
 		}
 
-		// Генерим пдфку
-		outputPath := filepath.Join(s.cfg.Application.Output, fmt.Sprintf("%s.pdf", unitGUID))
-		err = s.generatePDF(unitGUID, messages, outputPath)
-		if err != nil {
-			s.logger.Error("failed to generate PDF",
+		// отчет в каждом формате из конфига кладется рядом
+		for _, renderer := range s.renderers {
+			outputPath, err := s.writeReport(renderer, unitGUID, messages)
+			if err != nil {
+				s.logger.Error("failed to generate report",
+					"unit_guid", unitGUID,
+					"format", renderer.Extension(),
+					"error", err)
+				continue
+			}
+
+			s.logger.Info("report generated/updated",
 				"unit_guid", unitGUID,
-				"error", err)
-			continue
+				"format", renderer.Extension(),
+				"messages", len(messages),
+				"path", outputPath)
 		}
+	}
+
+	return nil
+}
 
-		s.logger.Info("PDF generated/updated",
-			"unit_guid", unitGUID,
-			"messages", len(messages),
-			"path", outputPath)
+// ingestFile - загружает файл из input папки, формат определяет парсер
+func (s *Scanner) ingestFile(ctx context.Context, filePath, fileName string, devices map[string]bool) error {
+	// открываем файл потоково: в памяти только текущая пачка сообщений
+	stream, err := parser.Open(filePath, s.parserOptions(fileName))
+	if err != nil {
+		return fmt.Errorf("parse error: %w", err)
 	}
+	defer stream.Close()
 
-	// по идее можно файл обработанный убрать из input папки и кинуть, допустим в архив или что-то такое
-	// в тз нету, поэтому оставляю так
+	return s.ingestStream(ctx, fileName, stream, devices)
+}
 
-	return nil
+// parserOptions - настройки парсера для файла: колонки и кодировка из профиля источника
+func (s *Scanner) parserOptions(fileName string) parser.Options {
+	source := s.cfg.Parser.Source(filepath.Base(fileName))
+	s.logger.Info("parsing file", "file", fileName, "source", source.Name)
+
+	return parser.Options{
+		Columns:  source.Columns,
+		Strict:   s.cfg.Parser.Strict,
+		Classes:  s.cfg.Parser.MessageClasses,
+		Encoding: source.Encoding,
+	}
 }
 
-// generatePDF - генерирует реальный PDF с данными устройства
-func (s *Scanner) generatePDF(unitGUID string, messages []models.DeviceMessage, outputPath string) error {
-	// Создаем PDF
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.AddPage()
-
-	// Добавляем шрифт с поддержкой кириллицы (DejaVu)
-	pdf.AddUTF8Font("DejaVu", "", "fonts/DejaVuSans.ttf")
-	pdf.AddUTF8Font("DejaVuBold", "", "fonts/DejaVuSans-Bold.ttf")
-
-	// Заголовок - жирный шрифт
-	pdf.SetFont("DejaVuBold", "", 16)
-	pdf.Cell(0, 10, "Отчет по устройству")
-	pdf.Ln(15)
-
-	// Информация об устройстве - обычный шрифт
-	pdf.SetFont("DejaVu", "", 11)
-	pdf.Cell(0, 7, "Unit GUID: "+unitGUID)
-	pdf.Ln(8)
-
-	if len(messages) > 0 {
-		pdf.Cell(0, 7, "Инвентарный номер: "+messages[0].Invid)
-		pdf.Ln(8)
-	}
-
-	pdf.Cell(0, 7, "Всего сообщений: "+fmt.Sprint(len(messages)))
-	pdf.Ln(8)
-
-	pdf.Cell(0, 7, "Дата отчета: "+time.Now().Format("02.01.2006 15:04:05"))
-	pdf.Ln(15)
-
-	// Заголовки таблицы - жирный
-	pdf.SetFont("DejaVuBold", "", 10)
-	pdf.CellFormat(15, 7, "№", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(70, 7, "Сообщение", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(30, 7, "Класс", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(20, 7, "Уровень", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(55, 7, "Адрес", "1", 0, "C", false, 0, "")
-	pdf.Ln(-1)
-
-	// Данные - обычный шрифт
-	pdf.SetFont("DejaVu", "", 9)
-	for i, msg := range messages {
-		if i >= 30 {
-			pdf.SetFont("DejaVu", "I", 9) // курсив
-			pdf.CellFormat(0, 7, "... и еще "+fmt.Sprint(len(messages)-30)+" сообщений", "", 0, "L", false, 0, "")
-			break
-		}
+// ingestStream - пишет сообщения из открытого потока в БД под именем fileName
+func (s *Scanner) ingestStream(ctx context.Context, fileName string, stream *parser.Stream, devices map[string]bool) error {
+	s.logger.Info("file opened",
+		"file", fileName,
+		"format", stream.Format(),
+		"encoding", stream.Encoding())
 
-		// Обрезаем длинные строки
-		text := msg.MessageText
-		if len(text) > 30 {
-			text = text[:27] + "..."
+	batchSize := s.cfg.Application.BatchSize
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+
+	// по ходу чтения собираем девайсы и пишем прогресс
+	batches := stream.Batches(batchSize)
+	next := func() ([]models.DeviceMessage, error) {
+		batch, err := batches()
+		if err != nil {
+			return nil, err
 		}
 
-		addr := msg.Address
-		if len(addr) > 25 {
-			addr = addr[:22] + "..."
+		for _, msg := range batch {
+			devices[msg.UnitGUID] = true
 		}
 
-		pdf.CellFormat(15, 7, fmt.Sprint(i+1), "1", 0, "C", false, 0, "")
-		pdf.CellFormat(70, 7, text, "1", 0, "L", false, 0, "")
-		pdf.CellFormat(30, 7, msg.MessageClass, "1", 0, "L", false, 0, "")
-		pdf.CellFormat(20, 7, fmt.Sprint(msg.Level), "1", 0, "C", false, 0, "")
-		pdf.CellFormat(55, 7, addr, "1", 0, "L", false, 0, "")
-		pdf.Ln(-1)
+		s.logger.Info("ingest progress",
+			"file", fileName,
+			"rows", stream.Rows())
+
+		return batch, nil
+	}
+
+	// сейвим в базу сообщения и статус файла одной транзакцией
+	rejected := func() ([]models.RejectedRow, int) {
+		return stream.Rejected(), stream.RejectedCount()
+	}
+
+	saved, err := s.repo.IngestFile(ctx, fileName, next, rejected)
+	if err != nil {
+		return fmt.Errorf("save messages error: %w", err)
+	}
+
+	s.logger.Info("messages saved to DB",
+		"file", fileName,
+		"messages", saved,
+		"rejected", stream.RejectedCount())
+
+	return nil
+}
+
+// writeReport - рендерит отчет по устройству и пишет его в output папку
+func (s *Scanner) writeReport(renderer report.Renderer, unitGUID string, messages []models.DeviceMessage) (string, error) {
+	data, err := renderer.Render(report.NewDevice(unitGUID, messages), messages)
+	if err != nil {
+		return "", err
+	}
+
+	outputPath := filepath.Join(s.cfg.Application.Output, fmt.Sprintf("%s.%s", unitGUID, renderer.Extension()))
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return "", fmt.Errorf("write report: %w", err)
 	}
 
-	return pdf.OutputFileAndClose(outputPath)
+	return outputPath, nil
 }
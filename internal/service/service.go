@@ -2,21 +2,64 @@ package service
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/report"
 	"github.com/alonsoF100/reporting-service/internal/repository/postgres"
 )
 
 type DeviceService struct {
-	repo *postgres.Repository
+	repo     *postgres.Repository
+	fontsDir string
 }
 
-func NewDeviceService(repo *postgres.Repository) *DeviceService {
+func NewDeviceService(repo *postgres.Repository, fontsDir string) *DeviceService {
 	return &DeviceService{
-		repo: repo,
+		repo:     repo,
+		fontsDir: fontsDir,
 	}
 }
 
-func (s *DeviceService) GetDeviceMessages(ctx context.Context, unitGUID string, page, limit int) ([]models.DeviceMessage, int, error) {
-	return s.repo.GetMessagesByUnitGUIDWithPagination(ctx, unitGUID, page, limit)
+func (s *DeviceService) GetDeviceMessages(
+	ctx context.Context,
+	unitGUID string,
+	filter models.MessageFilter,
+	page, limit int,
+) ([]models.DeviceMessage, int, error) {
+	return s.repo.GetMessagesByUnitGUIDWithPagination(ctx, unitGUID, filter, page, limit)
+}
+
+// GetDeviceReport - рендерит отчет по устройству в нужном формате прямо из БД
+func (s *DeviceService) GetDeviceReport(
+	ctx context.Context,
+	unitGUID, format string,
+	filter models.MessageFilter,
+) (*models.Report, error) {
+	const op = "service.GetDeviceReport"
+
+	renderer, err := report.NewRenderer(format, s.fontsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.repo.GetMessagesByUnitGUID(ctx, unitGUID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(messages) == 0 {
+		return nil, models.ErrNoMessages
+	}
+
+	data, err := renderer.Render(report.NewDevice(unitGUID, messages), messages)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.Report{
+		FileName:    fmt.Sprintf("%s.%s", unitGUID, renderer.Extension()),
+		ContentType: renderer.ContentType(),
+		Data:        data,
+	}, nil
 }
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// маркеры готовности: data.tsv считается дописанным, когда рядом есть data.tsv.done или data.tsv.ready
+var readyMarkerExts = []string{".done", ".ready"}
+
+// fileState - размер и mtime файла на момент последней проверки
+type fileState struct {
+	size     int64
+	modTime  time.Time
+	seenAt   time.Time
+	checking bool // уже запланирована повторная проверка
+}
+
+// admit - пропускает файл в очередь, только когда он точно дописан:
+// при ready_markers ждем файл-маркер, иначе размер и mtime не должны меняться stability_window
+func (s *Scanner) admit(ctx context.Context, fileName string) {
+	if s.cfg.Application.ReadyMarkers {
+		if !s.hasReadyMarker(fileName) {
+			s.logger.Debug("waiting for ready marker", "file", fileName)
+			return
+		}
+		s.enqueue(ctx, fileName)
+		return
+	}
+
+	if s.cfg.Application.StabilityWindow <= 0 {
+		s.enqueue(ctx, fileName)
+		return
+	}
+
+	s.checkStable(ctx, fileName)
+}
+
+// checkStable - сравнивает размер и mtime с прошлой проверкой и,
+// если файл еще меняется, перепроверяет его через stability_window
+func (s *Scanner) checkStable(ctx context.Context, fileName string) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	info, err := os.Stat(filepath.Join(s.cfg.Application.Input, fileName))
+	if err != nil {
+		s.forget(fileName)
+		s.logger.Debug("file disappeared before it became stable", "file", fileName, "error", err)
+		return
+	}
+
+	window := s.cfg.Application.StabilityWindow
+
+	s.mu.Lock()
+	state, seen := s.observed[fileName]
+	switch {
+	case seen && state.size == info.Size() && state.modTime.Equal(info.ModTime()) && time.Since(state.seenAt) >= window:
+		delete(s.observed, fileName)
+		s.mu.Unlock()
+
+		s.enqueue(ctx, fileName)
+		return
+
+	case !seen || state.size != info.Size() || !state.modTime.Equal(info.ModTime()):
+		state.size = info.Size()
+		state.modTime = info.ModTime()
+		state.seenAt = time.Now()
+	}
+
+	// повторная проверка уже запланирована - второй таймер не нужен
+	if state.checking {
+		s.observed[fileName] = state
+		s.mu.Unlock()
+		return
+	}
+
+	state.checking = true
+	s.observed[fileName] = state
+	s.mu.Unlock()
+
+	s.logger.Debug("file is not stable yet", "file", fileName, "size", info.Size(), "recheck_in", window)
+
+	time.AfterFunc(window, func() {
+		s.mu.Lock()
+		if st, ok := s.observed[fileName]; ok {
+			st.checking = false
+			s.observed[fileName] = st
+		}
+		s.mu.Unlock()
+
+		s.checkStable(ctx, fileName)
+	})
+}
+
+// forget - убирает файл из наблюдения за стабильностью
+func (s *Scanner) forget(fileName string) {
+	s.mu.Lock()
+	delete(s.observed, fileName)
+	s.mu.Unlock()
+}
+
+// hasReadyMarker - есть ли рядом с файлом маркер готовности
+func (s *Scanner) hasReadyMarker(fileName string) bool {
+	for _, ext := range readyMarkerExts {
+		if _, err := os.Stat(filepath.Join(s.cfg.Application.Input, fileName+ext)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// markerTarget - для маркера готовности возвращает имя файла, к которому он относится
+func markerTarget(name string) (string, bool) {
+	for _, ext := range readyMarkerExts {
+		if target, ok := strings.CutSuffix(name, ext); ok && isInputFile(target) {
+			return target, true
+		}
+	}
+	return "", false
+}
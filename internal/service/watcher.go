@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch - следит за input папкой через fsnotify и ставит файл в очередь,
+// как только запись в него закончилась. fsnotify не отдает переносимо событие
+// закрытия файла, поэтому концом записи считаем отсутствие событий в течение watch_delay
+func (s *Scanner) Watch(ctx context.Context) error {
+	const op = "service.Scanner.Watch"
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(s.cfg.Application.Input); err != nil {
+		return fmt.Errorf("%s: watch %s: %w", op, s.cfg.Application.Input, err)
+	}
+
+	s.logger.Info("watcher started",
+		"dir", s.cfg.Application.Input,
+		"delay", s.cfg.Application.WatchDelay)
+
+	// таймер на каждый файл перезапускается при каждом событии записи
+	timers := make(map[string]*time.Timer)
+	ready := make(chan string)
+
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return fmt.Errorf("%s: events channel closed", op)
+			}
+
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+
+			// появление маркера готовности означает, что его файл можно брать
+			fileName := filepath.Base(event.Name)
+			if target, ok := markerTarget(fileName); ok {
+				fileName = target
+			}
+
+			if !isInputFile(fileName) {
+				continue
+			}
+
+			if timer, ok := timers[fileName]; ok {
+				timer.Reset(s.cfg.Application.WatchDelay)
+				continue
+			}
+
+			s.logger.Debug("file changed", "file", fileName, "op", event.Op.String())
+			timers[fileName] = time.AfterFunc(s.cfg.Application.WatchDelay, func() {
+				select {
+				case ready <- fileName:
+				case <-ctx.Done():
+				}
+			})
+
+		case fileName := <-ready:
+			delete(timers, fileName)
+			s.enqueueNew(ctx, fileName)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return fmt.Errorf("%s: errors channel closed", op)
+			}
+			// переполнение очереди событий не страшно - файлы подберет периодический скан
+			s.logger.Error("watcher error", "error", err)
+
+		case <-ctx.Done():
+			s.logger.Info("watcher stopped")
+			return nil
+		}
+	}
+}
+
+// enqueueNew - ставит в очередь файл, о котором еще нет записи в processed_files.
+// Файлы с ошибкой повторяет периодический скан
+func (s *Scanner) enqueueNew(ctx context.Context, fileName string) {
+	processed, err := s.repo.IsFileProcessed(ctx, fileName)
+	if err != nil {
+		s.logger.Error("failed to check file status", "file", fileName, "error", err)
+		return
+	}
+
+	if processed {
+		s.logger.Debug("file already known, skipping", "file", fileName)
+		return
+	}
+
+	s.logger.Info("new file found", "file", fileName)
+	s.admit(ctx, fileName)
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alonsoF100/reporting-service/internal/config"
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/repository/postgres"
+)
+
+// BenchmarkIngestFile - загрузка больших файлов через COPY, нужна поднятая БД (docker-compose up -d):
+//
+//	go test -run '^$' -bench IngestFile -benchtime 3x ./internal/test
+func BenchmarkIngestFile(b *testing.B) {
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{
+			Host:     "localhost",
+			Port:     5432,
+			User:     "postgres",
+			Password: "postgres",
+			Name:     "reporting-service",
+			SSLMode:  "disable",
+		},
+	}
+
+	pool, err := postgres.NewPool(cfg)
+	if err != nil {
+		b.Skipf("database is not available: %v", err)
+	}
+	defer pool.Close()
+
+	repo := postgres.New(pool)
+	ctx := context.Background()
+
+	// раньше multi-row INSERT падал уже на ~5400 строках из-за лимита параметров
+	for _, size := range []int{10_000, 100_000, 300_000} {
+		messages := make([]models.DeviceMessage, size)
+		for i := range messages {
+			messages[i] = models.DeviceMessage{
+				Number:       i + 1,
+				Invid:        "G-044322",
+				UnitGUID:     "01749246-95f6-57db-b7c3-2ae0e8be671f",
+				MessageID:    fmt.Sprintf("cold7_status_%d", i),
+				MessageText:  "Разморозка",
+				MessageClass: "waiting",
+				Level:        100,
+				Area:         "LOCAL",
+				Address:      "cold7_status.Defrost_status",
+				SourceRow:    i + 3,
+			}
+		}
+
+		fileName := fmt.Sprintf("bench_%d.tsv", size)
+
+		b.Run(fmt.Sprintf("rows=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.IngestFile(ctx, fileName, models.BatchOf(messages), nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "rows/s")
+		})
+
+		_, _ = pool.Exec(ctx, "DELETE FROM device_messages WHERE source_file = $1", fileName)
+		_, _ = pool.Exec(ctx, "DELETE FROM processed_files WHERE file_name = $1", fileName)
+	}
+}
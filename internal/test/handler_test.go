@@ -0,0 +1,388 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/transport/handler"
+	"github.com/alonsoF100/reporting-service/internal/transport/router"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubService - сервисы без БД, запоминают последний запрошенный отчет и загруженный файл
+type stubService struct {
+	format string
+	filter models.MessageFilter
+
+	uploadedName string
+	uploaded     string
+	status       string
+	reprocessed  string
+}
+
+const (
+	testGUID    = "01749246-95f6-57db-b7c3-2ae0e8be671f"
+	missingGUID = "00000000-0000-0000-0000-000000000000"
+)
+
+func (s *stubService) GetDeviceMessages(ctx context.Context, unitGUID string, filter models.MessageFilter, page, limit int) ([]models.DeviceMessage, int, error) {
+	s.filter = filter
+	if unitGUID == missingGUID {
+		return nil, 0, nil
+	}
+	return []models.DeviceMessage{{UnitGUID: unitGUID, SourceFile: "data.tsv", SourceRow: 3}}, 1, nil
+}
+
+func (s *stubService) GetDeviceReport(ctx context.Context, unitGUID, format string, filter models.MessageFilter) (*models.Report, error) {
+	s.format = format
+	s.filter = filter
+
+	switch {
+	case format == "docx":
+		return nil, models.ErrUnknownFormat
+	case unitGUID == missingGUID:
+		return nil, models.ErrNoMessages
+	}
+
+	return &models.Report{
+		FileName:    unitGUID + "." + format,
+		ContentType: "text/csv; charset=utf-8",
+		Data:        []byte("number\n1\n"),
+	}, nil
+}
+
+func (s *stubService) GetFileRejections(ctx context.Context, fileName string, page, limit int) ([]models.RejectedRow, int, int, error) {
+	switch fileName {
+	case "missing.tsv":
+		return nil, 0, 0, models.ErrFileNotFound
+	case "data.tsv":
+		return []models.RejectedRow{{FileName: fileName, Row: 5, Reason: "message_id is empty"}}, 1, 1500, nil
+	}
+	return nil, 0, 0, nil
+}
+
+func (s *stubService) UploadFile(ctx context.Context, fileName string, body io.Reader) (*models.ProcessedFile, error) {
+	switch {
+	case !strings.HasSuffix(fileName, ".tsv"):
+		return nil, models.ErrUnsupportedFile
+	case fileName == "busy.tsv":
+		return nil, models.ErrFileExists
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	s.uploadedName, s.uploaded = fileName, string(data)
+
+	return &models.ProcessedFile{ID: 42, FileName: fileName, Status: models.StatusQueued}, nil
+}
+
+func (s *stubService) GetFile(ctx context.Context, fileName string) (*models.FileDetails, error) {
+	if fileName != s.uploadedName {
+		return nil, models.ErrFileNotFound
+	}
+	return &models.FileDetails{
+		ProcessedFile: models.ProcessedFile{ID: 42, FileName: fileName, Status: models.StatusProcessed, Attempts: 1},
+		Messages:      2,
+		Devices:       []string{"01749246-95f6-57db-b7c3-2ae0e8be671f"},
+	}, nil
+}
+
+func (s *stubService) GetFileByID(ctx context.Context, id int64) (*models.FileDetails, error) {
+	if id != 42 {
+		return nil, models.ErrFileNotFound
+	}
+	return s.GetFile(ctx, s.uploadedName)
+}
+
+func (s *stubService) ListFiles(ctx context.Context, status string, page, limit int) ([]models.ProcessedFile, int, error) {
+	s.status = status
+	switch status {
+	case "unknown":
+		return nil, 0, models.ErrUnknownStatus
+	case models.StatusQueued:
+		return nil, 0, nil
+	}
+	return []models.ProcessedFile{{ID: 7, FileName: "bad.tsv", Status: models.StatusError, ErrorMessage: "parse error", Attempts: 3}}, 1, nil
+}
+
+func (s *stubService) ReprocessFile(ctx context.Context, fileName string) (*models.ProcessedFile, error) {
+	switch fileName {
+	case "missing.tsv":
+		return nil, models.ErrFileNotFound
+	case "busy.tsv":
+		return nil, models.ErrFileBusy
+	case "gone.tsv":
+		return nil, models.ErrFileGone
+	}
+	s.reprocessed = fileName
+	return &models.ProcessedFile{ID: 7, FileName: fileName, Status: models.StatusQueued}, nil
+}
+
+func TestDeviceReportHandler(t *testing.T) {
+	svc := &stubService{}
+	r := router.New(handler.New(svc, svc, 0)).Setup()
+
+	t.Run("ok", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+testGUID+"/report?format=csv&from=2026-01-01&to=2026-01-31&class=alarm,warning&class=info", nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "attachment; filename="+testGUID+".csv", rec.Header().Get("Content-Disposition"))
+		assert.Equal(t, "number\n1\n", rec.Body.String())
+
+		assert.Equal(t, "csv", svc.format)
+		assert.Equal(t, []string{"alarm", "warning", "info"}, svc.filter.Classes)
+		assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local), svc.filter.From)
+		// дата без времени в to включает весь день
+		assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local), svc.filter.To)
+	})
+
+	t.Run("default format", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+testGUID+"/report", nil)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "pdf", svc.format)
+	})
+
+	tests := []struct {
+		name string
+		url  string
+		code int
+	}{
+		{"unknown format", "/api/v1/devices/" + testGUID + "/report?format=docx", http.StatusBadRequest},
+		{"invalid from", "/api/v1/devices/" + testGUID + "/report?from=yesterday", http.StatusBadRequest},
+		{"from after to", "/api/v1/devices/" + testGUID + "/report?from=2026-02-01&to=2026-01-01", http.StatusBadRequest},
+		{"no messages", "/api/v1/devices/" + missingGUID + "/report", http.StatusNotFound},
+		{"not a guid", "/api/v1/devices/abc'1/report", http.StatusBadRequest},
+		{"messages not a guid", "/api/v1/devices/abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+}
+
+func TestDeviceMessagesHandlerSourceFile(t *testing.T) {
+	svc := &stubService{}
+	r := router.New(handler.New(svc, svc, 0)).Setup()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+testGUID+"?source_file=data.tsv", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "data.tsv", svc.filter.SourceFile)
+
+	var body struct {
+		Messages []models.DeviceMessage `json:"messages"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Len(t, body.Messages, 1)
+	assert.Equal(t, "data.tsv", body.Messages[0].SourceFile)
+	assert.Equal(t, 3, body.Messages[0].SourceRow)
+}
+
+func TestFileRejectionsHandler(t *testing.T) {
+	r := router.New(handler.New(nil, &stubService{}, 0)).Setup()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/data.tsv/rejections", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Total         int                  `json:"total"`
+		RejectedTotal int                  `json:"rejected_total"`
+		Truncated     bool                 `json:"truncated"`
+		Rejected      []models.RejectedRow `json:"rejected"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, 1, body.Total)
+	// сохранена только часть отклоненных строк - список помечен неполным
+	assert.Equal(t, 1500, body.RejectedTotal)
+	assert.True(t, body.Truncated)
+	require.Len(t, body.Rejected, 1)
+	assert.Equal(t, 5, body.Rejected[0].Row)
+	assert.Equal(t, "message_id is empty", body.Rejected[0].Reason)
+
+	// у файла без отклоненных строк пустой список, а не null
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/clean.tsv/rejections", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"rejected":[]`)
+
+	// неизвестный файл - 404, а не пустой список
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files/missing.tsv/rejections", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUploadFileHandler(t *testing.T) {
+	svc := &stubService{}
+	r := router.New(handler.New(svc, svc, 256)).Setup()
+
+	t.Run("multipart", func(t *testing.T) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", "upload.tsv")
+		require.NoError(t, err)
+		_, _ = fw.Write([]byte("n\tunit_guid\n"))
+		require.NoError(t, mw.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/files", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, "/api/v1/files/id/42", rec.Header().Get("Location"))
+		assert.Equal(t, "n\tunit_guid\n", svc.uploaded)
+
+		var file models.ProcessedFile
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&file))
+		assert.Equal(t, int64(42), file.ID)
+		assert.Equal(t, models.StatusQueued, file.Status)
+
+		// статус загрузки можно опрашивать по Location (id) и по имени
+		for _, url := range []string{rec.Header().Get("Location"), "/api/v1/files/upload.tsv"} {
+			rec = httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+			require.Equal(t, http.StatusOK, rec.Code, url)
+			assert.Contains(t, rec.Body.String(), `"id":42`, url)
+			assert.Contains(t, rec.Body.String(), `"status":"processed"`, url)
+			assert.Contains(t, rec.Body.String(), `"attempts":1`, url)
+			assert.Contains(t, rec.Body.String(), `"messages":2`, url)
+		}
+	})
+
+	t.Run("raw body", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/files?name=raw.tsv", strings.NewReader("raw")))
+
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, "raw.tsv", svc.uploadedName)
+		assert.Equal(t, "raw", svc.uploaded)
+	})
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		code int
+	}{
+		{"raw without name", "/api/v1/files", "raw", http.StatusBadRequest},
+		{"unsupported type", "/api/v1/files?name=notes.txt", "raw", http.StatusBadRequest},
+		{"already waiting", "/api/v1/files?name=busy.tsv", "raw", http.StatusConflict},
+		{"too large", "/api/v1/files?name=big.tsv", strings.Repeat("x", 257), http.StatusRequestEntityTooLarge},
+		{"unknown file", "/api/v1/files/missing.tsv", "", http.StatusNotFound},
+		{"unknown file id", "/api/v1/files/id/7", "", http.StatusNotFound},
+		{"invalid file id", "/api/v1/files/id/upload.tsv", "", http.StatusBadRequest},
+		{"negative file id", "/api/v1/files/id/-1", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodPost
+			if tt.body == "" {
+				method = http.MethodGet
+			}
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(method, tt.url, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+}
+
+func TestFilesHandler(t *testing.T) {
+	svc := &stubService{}
+	r := router.New(handler.New(nil, svc, 0)).Setup()
+
+	t.Run("list", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files?status=error&page=1&limit=10", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, models.StatusError, svc.status)
+
+		var body struct {
+			Total int                    `json:"total"`
+			Pages int                    `json:"pages"`
+			Files []models.ProcessedFile `json:"files"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, 1, body.Total)
+		assert.Equal(t, 1, body.Pages)
+		require.Len(t, body.Files, 1)
+		assert.Equal(t, "parse error", body.Files[0].ErrorMessage)
+		assert.Equal(t, 3, body.Files[0].Attempts)
+	})
+
+	t.Run("empty list", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/files?status=queued", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"files":[]`)
+	})
+
+	t.Run("reprocess", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/files/bad.tsv/reprocess", nil))
+
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, "/api/v1/files/id/7", rec.Header().Get("Location"))
+		assert.Contains(t, rec.Body.String(), `"status":"queued"`)
+	})
+
+	// файл из zip: слеш в имени экранирован в пути запроса
+	t.Run("reprocess archive entry", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/files/bundle.zip%2Fplant%2Fb.tsv/reprocess", nil))
+
+		require.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, "bundle.zip/plant/b.tsv", svc.reprocessed)
+		assert.Equal(t, "/api/v1/files/id/7", rec.Header().Get("Location"))
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		code   int
+	}{
+		{"unknown status", http.MethodGet, "/api/v1/files?status=unknown", http.StatusBadRequest},
+		{"reprocess unknown file", http.MethodPost, "/api/v1/files/missing.tsv/reprocess", http.StatusNotFound},
+		{"reprocess busy file", http.MethodPost, "/api/v1/files/busy.tsv/reprocess", http.StatusConflict},
+		{"reprocess gone file", http.MethodPost, "/api/v1/files/gone.tsv/reprocess", http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.url, nil))
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+}
@@ -2,17 +2,20 @@ package test
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alonsoF100/reporting-service/internal/config"
 	"github.com/alonsoF100/reporting-service/internal/models"
 	"github.com/alonsoF100/reporting-service/internal/parser"
+	"github.com/alonsoF100/reporting-service/internal/report"
 	"github.com/alonsoF100/reporting-service/internal/repository/postgres"
 	"github.com/alonsoF100/reporting-service/internal/service"
 	"github.com/alonsoF100/reporting-service/internal/transport/handler"
@@ -29,24 +32,19 @@ func TestIntegration(t *testing.T) {
 
 	// 1. Конфиг для тестов
 	cfg := &config.Config{
-		Database: config.DatabaseConfig{
-			Host:     "localhost",
-			Port:     5432,
-			User:     "postgres",
-			Password: "postgres",
-			Name:     "reporting-service",
-			SSLMode:  "disable",
-		},
+		Database: testDatabase,
 		Migration: config.MigrationsConfig{
 			Dir: "", // без миграций
 		},
 		Application: config.ApplicationConfig{
-			Input:      "testdata/input",
-			Output:     "testdata/output",
-			Period:     1 * time.Second,
-			QueueSize:  10,
-			Workers:    2,
-			MaxRetries: 1,
+			Input:   "testdata/input",
+			Output:  "testdata/output",
+			Fonts:   "../../fonts",
+			Period:  1 * time.Second,
+			Workers: 2,
+		},
+		Retry: config.RetryConfig{
+			MaxAttempts: 1,
 		},
 		Server: config.ServerConfig{
 			Port: 8081,
@@ -72,10 +70,13 @@ func TestIntegration(t *testing.T) {
 	require.NoError(t, err)
 	_, err = pool.Exec(context.Background(), "TRUNCATE processed_files CASCADE")
 	require.NoError(t, err)
+	_, err = pool.Exec(context.Background(), "TRUNCATE jobs")
+	require.NoError(t, err)
 
 	defer func() {
 		_, _ = pool.Exec(context.Background(), "TRUNCATE device_messages CASCADE")
 		_, _ = pool.Exec(context.Background(), "TRUNCATE processed_files CASCADE")
+		_, _ = pool.Exec(context.Background(), "TRUNCATE jobs")
 	}()
 
 	// 5. Создаем тестовый TSV файл
@@ -90,8 +91,8 @@ n 	mqtt	invid   	unit_guid                           	msg_id
 	require.NoError(t, err)
 
 	// 6. Создаем сервисы
-	deviceService := service.NewDeviceService(repo)
-	scanner := service.NewScanner(cfg, repo)
+	deviceService := service.NewDeviceService(repo, cfg.Application.Fonts)
+	scanner := service.NewScanner(cfg, repo, []report.Renderer{report.NewPDFRenderer(cfg.Application.Fonts)})
 
 	// 7. Запускаем сканер в фоне
 	ctx, cancel := context.WithCancel(context.Background())
@@ -115,6 +116,20 @@ n 	mqtt	invid   	unit_guid                           	msg_id
 	require.NoError(t, err)
 	assert.Len(t, messages, 1, "device2 should have 1 message")
 
+	// сообщение знает файл и строку, из которых загружено
+	assert.Equal(t, "test.tsv", messages[0].SourceFile)
+	assert.Equal(t, 5, messages[0].SourceRow)
+
+	// 10.1 Повторная загрузка того же файла заменяет его сообщения, а не дублирует
+	reloaded, err := parser.Parse(testFile)
+	require.NoError(t, err)
+	_, err = repo.IngestFile(ctx, "test.tsv", models.BatchOf(reloaded.Messages), nil)
+	require.NoError(t, err)
+
+	messages, err = repo.GetAllMessagesByUnitGUID(ctx, "01749246-95f6-57db-b7c3-2ae0e8be671f")
+	require.NoError(t, err)
+	assert.Len(t, messages, 2, "reingest must not duplicate messages")
+
 	// 11. НЕ проверяем PDF - пропускаем
 	// files, err := filepath.Glob(filepath.Join(cfg.Application.Output, "*.pdf"))
 	// require.NoError(t, err)
@@ -122,7 +137,8 @@ n 	mqtt	invid   	unit_guid                           	msg_id
 
 	// 12. Тестируем API
 	logger := slog.Default()
-	h := handler.New(deviceService)
+	fileService := service.NewFileService(repo, scanner, cfg.Application.Input)
+	h := handler.New(deviceService, fileService, 1<<20)
 	r := router.New(h).Setup()
 	srv := server.New(cfg, h, logger)
 	srv.Server.Handler = r
@@ -170,6 +186,50 @@ n 	mqtt	invid   	unit_guid                           	msg_id
 	require.NoError(t, err)
 	defer resp.Body.Close()
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 15. Тестируем отчет по запросу
+	resp, err = http.Get("http://localhost:8081/api/v1/devices/01749246-95f6-57db-b7c3-2ae0e8be671f/report?format=csv&class=waiting")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, records, 2, "header and one waiting message")
+
+	// 16. Сводка по файлу: попытки, сообщения и устройства
+	details, err := repo.GetFileDetails(ctx, "test.tsv")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusProcessed, details.Status)
+	assert.Equal(t, 1, details.Attempts)
+	assert.Equal(t, 3, details.Messages)
+	assert.Len(t, details.Devices, 2)
+
+	files, total, err := repo.ListProcessedFiles(ctx, models.StatusProcessed, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, files, 1)
+	assert.Equal(t, "test.tsv", files[0].FileName)
+
+	_, _, _, err = repo.GetRejectedRows(ctx, "missing.tsv", 1, 10)
+	assert.ErrorIs(t, err, models.ErrFileNotFound)
+
+	// 17. Из одновременных загрузок с одним именем проходит одна, вторая не затирает первую
+	codes := make(chan int, 2)
+	for _, body := range []string{testData, strings.Replace(testData, "Разморозка", "Оттайка", 1)} {
+		go func() {
+			resp, err := http.Post("http://localhost:8081/api/v1/files?name=race.tsv", "text/tab-separated-values", strings.NewReader(body))
+			if err != nil {
+				codes <- 0
+				return
+			}
+			resp.Body.Close()
+			codes <- resp.StatusCode
+		}()
+	}
+	got := []int{<-codes, <-codes}
+	assert.ElementsMatch(t, []int{http.StatusAccepted, http.StatusConflict}, got)
 }
 
 func TestParserIntegration(t *testing.T) {
@@ -190,13 +250,15 @@ n 	mqtt	invid   	unit_guid                           	msg_id
 	tmpFile.Close()
 
 	// Тестируем парсер
-	result, err := parser.ParseTSV(tmpFile.Name())
+	result, err := parser.Parse(tmpFile.Name())
 	require.NoError(t, err)
 
 	// Должно быть 3 сообщения (строка 3 - пустая, пропускается)
 	assert.Len(t, result.Messages, 3)
 
 	// Проверяем первое сообщение
+	assert.Equal(t, filepath.Base(tmpFile.Name()), result.Messages[0].SourceFile)
+	assert.Equal(t, 3, result.Messages[0].SourceRow)
 	assert.Equal(t, 1, result.Messages[0].Number)
 	assert.Equal(t, "G-044322", result.Messages[0].Invid)
 	assert.Equal(t, "01749246-95f6-57db-b7c3-2ae0e8be671f", result.Messages[0].UnitGUID)
@@ -0,0 +1,408 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/repository/postgres"
+)
+
+// memoryRepo - репозиторий в памяти для тестов сканера без БД
+type memoryRepo struct {
+	mu       sync.Mutex
+	files    map[string]*models.ProcessedFile
+	messages []models.DeviceMessage
+	rejected map[string][]models.RejectedRow
+	ingests  map[string]int
+	order    []string // порядок загрузки файлов
+	jobs     map[string]*models.Job
+	jobID    int64
+	failures map[string]int // сколько раз IngestFile упадет для файла
+
+	// если задан, IngestFile сообщает сюда имя файла и ждет отмены контекста
+	ingesting chan string
+}
+
+func newMemoryRepo() *memoryRepo {
+	return &memoryRepo{
+		files:    make(map[string]*models.ProcessedFile),
+		rejected: make(map[string][]models.RejectedRow),
+		ingests:  make(map[string]int),
+		jobs:     make(map[string]*models.Job),
+		failures: make(map[string]int),
+	}
+}
+
+func (r *memoryRepo) file(fileName string) *models.ProcessedFile {
+	f, ok := r.files[fileName]
+	if !ok {
+		f = &models.ProcessedFile{FileName: fileName, Revision: 1}
+		r.files[fileName] = f
+	}
+	return f
+}
+
+func (r *memoryRepo) IsFileProcessed(ctx context.Context, fileName string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.files[fileName]
+	return ok, nil
+}
+
+func (r *memoryRepo) GetAllProcessedFiles(ctx context.Context) ([]models.ProcessedFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var files []models.ProcessedFile
+	for _, f := range r.files {
+		files = append(files, *f)
+	}
+	return files, nil
+}
+
+func (r *memoryRepo) UpdateFileStatus(ctx context.Context, fileName string, status, errorMsg string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(fileName)
+	f.Status = status
+	f.ErrorMessage = errorMsg
+	f.WorkerID, f.LeaseExpiresAt, f.NextRetryAt = "", nil, nil
+	f.ErrorCategory = ""
+	if status == models.StatusQueued {
+		f.Attempts = 0
+	}
+	return nil
+}
+
+func (r *memoryRepo) AbortFileAttempt(ctx context.Context, fileName, workerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(fileName)
+	if f.Status != models.StatusProcessing || f.WorkerID != workerID {
+		return models.ErrLeaseLost
+	}
+	f.Status = models.StatusQueued
+	f.Attempts = max(f.Attempts-1, 0)
+	f.WorkerID, f.LeaseExpiresAt = "", nil
+	return nil
+}
+
+func (r *memoryRepo) ScheduleFileRetry(ctx context.Context, fileName, errorMsg string, retryAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(fileName)
+	f.Status = models.StatusError
+	f.ErrorMessage = errorMsg
+	f.NextRetryAt = &retryAt
+	f.ErrorCategory = models.ErrorTransient
+	f.WorkerID, f.LeaseExpiresAt = "", nil
+	return nil
+}
+
+func (r *memoryRepo) MarkFileFailed(ctx context.Context, fileName, category, errorMsg string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(fileName)
+	f.Status = models.StatusFailed
+	f.ErrorMessage = errorMsg
+	f.ErrorCategory = category
+	f.WorkerID, f.LeaseExpiresAt, f.NextRetryAt = "", nil, nil
+	return nil
+}
+
+func (r *memoryRepo) GetProcessedFileByHash(ctx context.Context, contentHash string) (*models.ProcessedFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.files {
+		if f.ContentHash == contentHash && f.Status == models.StatusProcessed {
+			found := *f
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepo) SetFileHash(ctx context.Context, fileName, contentHash string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(fileName)
+	if f.ContentHash != "" && f.ContentHash != contentHash {
+		f.Revision++
+		f.Attempts = 0
+	}
+	f.ContentHash = contentHash
+	f.DuplicateOf = ""
+	f.Status = models.StatusProcessing
+	return f.Revision, nil
+}
+
+func (r *memoryRepo) MarkFileDuplicate(ctx context.Context, fileName, contentHash, duplicateOf string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(fileName)
+	f.Status = models.StatusDuplicate
+	f.ContentHash = contentHash
+	f.DuplicateOf = duplicateOf
+	f.WorkerID, f.LeaseExpiresAt = "", nil
+	return nil
+}
+
+func (r *memoryRepo) ClaimFile(ctx context.Context, fileName, contentHash, workerID string, lease time.Duration) (bool, *models.ProcessedFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if f, ok := r.files[fileName]; ok && !f.Claimable(contentHash, now, lease) {
+		current := *f
+		return false, &current, nil
+	}
+	f := r.file(fileName)
+	expires := now.Add(lease)
+	f.Status = models.StatusProcessing
+	f.WorkerID, f.HeartbeatAt, f.LeaseExpiresAt = workerID, &now, &expires
+	f.ProcessedAt = now
+	return true, nil, nil
+}
+
+func (r *memoryRepo) StartFileAttempt(ctx context.Context, fileName, workerID string, lease time.Duration) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(fileName)
+	now := time.Now()
+	expires := now.Add(lease)
+	f.Status = models.StatusProcessing
+	f.Attempts++
+	f.WorkerID, f.HeartbeatAt, f.LeaseExpiresAt = workerID, &now, &expires
+	return f.Attempts, nil
+}
+
+func (r *memoryRepo) HeartbeatFile(ctx context.Context, fileName, workerID string, lease time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.files[fileName]
+	if !ok || f.Status != models.StatusProcessing || f.WorkerID != workerID {
+		return models.ErrLeaseLost
+	}
+	now := time.Now()
+	expires := now.Add(lease)
+	f.HeartbeatAt, f.LeaseExpiresAt = &now, &expires
+	return nil
+}
+
+func (r *memoryRepo) ReapExpiredLeases(ctx context.Context, lease time.Duration) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var reaped []string
+	for name, f := range r.files {
+		if f.Status == models.StatusProcessing && f.ArchivePath == "" &&
+			f.LeaseExpiresAt != nil && f.LeaseExpiresAt.Before(time.Now()) {
+			f.Status, f.WorkerID, f.LeaseExpiresAt = models.StatusQueued, "", nil
+			reaped = append(reaped, name)
+		}
+	}
+	return reaped, nil
+}
+
+func (r *memoryRepo) RegisterArchiveEntry(ctx context.Context, fileName, archivePath string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.file(fileName)
+	f.Status = models.StatusProcessing
+	f.ArchivePath = archivePath
+	return nil
+}
+
+func (r *memoryRepo) IngestFile(
+	ctx context.Context,
+	fileName string,
+	next models.NextBatch,
+	rejected func() ([]models.RejectedRow, int),
+) (int64, error) {
+	if r.ingesting != nil {
+		r.ingesting <- fileName
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+
+	var messages []models.DeviceMessage
+	for {
+		batch, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		messages = append(messages, batch...)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures[fileName] > 0 {
+		r.failures[fileName]--
+		return 0, &postgres.TransientError{Err: errors.New("connection reset by peer")}
+	}
+
+	kept := r.messages[:0]
+	for _, msg := range r.messages {
+		if msg.SourceFile != fileName {
+			kept = append(kept, msg)
+		}
+	}
+	for _, msg := range messages {
+		msg.SourceFile = fileName
+		kept = append(kept, msg)
+	}
+	r.messages = kept
+
+	f := r.file(fileName)
+
+	delete(r.rejected, fileName)
+	f.RejectedCount = 0
+	if rejected != nil {
+		rows, total := rejected()
+		if len(rows) > 0 {
+			r.rejected[fileName] = rows
+		}
+		f.RejectedCount = total
+	}
+
+	f.Status = models.StatusProcessed
+	f.ErrorMessage = ""
+	f.WorkerID, f.LeaseExpiresAt, f.NextRetryAt = "", nil, nil
+	f.ErrorCategory = ""
+	r.ingests[fileName]++
+	r.order = append(r.order, fileName)
+	return int64(len(messages)), nil
+}
+
+func (r *memoryRepo) GetAllMessagesByUnitGUID(ctx context.Context, unitGUID string) ([]models.DeviceMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var messages []models.DeviceMessage
+	for _, msg := range r.messages {
+		if msg.UnitGUID == unitGUID {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (r *memoryRepo) EnqueueJob(ctx context.Context, fileName string, priority int, force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.jobs[fileName]; ok {
+		job.Priority = max(job.Priority, priority)
+		job.Force = job.Force || force
+		if force {
+			job.NextRunAt = time.Now()
+		}
+		return nil
+	}
+	r.jobID++
+	r.jobs[fileName] = &models.Job{ID: r.jobID, FileName: fileName, Priority: priority, Force: force, NextRunAt: time.Now()}
+	return nil
+}
+
+func (r *memoryRepo) DequeueJob(ctx context.Context, workerID string, visibility time.Duration) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var next *models.Job
+	for _, job := range r.jobs {
+		if job.NextRunAt.After(now) || (job.LockedUntil != nil && job.LockedUntil.After(now)) {
+			continue
+		}
+		if next == nil || job.Priority > next.Priority ||
+			(job.Priority == next.Priority && job.NextRunAt.Before(next.NextRunAt)) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	until := now.Add(visibility)
+	next.LockedBy, next.LockedUntil = workerID, &until
+	next.Attempts++
+	job := *next
+	return &job, nil
+}
+
+func (r *memoryRepo) ExtendJob(ctx context.Context, id int64, workerID string, visibility time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.ID == id && job.LockedBy == workerID {
+			until := time.Now().Add(visibility)
+			job.LockedUntil = &until
+			return nil
+		}
+	}
+	return models.ErrLeaseLost
+}
+
+func (r *memoryRepo) CompleteJob(ctx context.Context, id int64, workerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, job := range r.jobs {
+		if job.ID == id && job.LockedBy == workerID {
+			delete(r.jobs, name)
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepo) ReleaseJob(ctx context.Context, id int64, workerID string, runAt time.Time, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		if job.ID == id && job.LockedBy == workerID {
+			job.LockedBy, job.LockedUntil = "", nil
+			job.NextRunAt, job.LastError = runAt, reason
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepo) status(fileName string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.files[fileName]; ok {
+		return f.Status
+	}
+	return ""
+}
+
+func (r *memoryRepo) rejectedRows(fileName string) []models.RejectedRow {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rejected[fileName]
+}
+
+func (r *memoryRepo) sourceFiles() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int)
+	for _, msg := range r.messages {
+		counts[msg.SourceFile]++
+	}
+	return counts
+}
+
+func (r *memoryRepo) messageCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.messages)
+}
+
+func (r *memoryRepo) processedFile(fileName string) models.ProcessedFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.files[fileName]; ok {
+		return *f
+	}
+	return models.ProcessedFile{}
+}
@@ -0,0 +1,348 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alonsoF100/reporting-service/internal/config"
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestStreamBatches(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "stream.tsv")
+	require.NoError(t, os.WriteFile(filePath, []byte(scannerTestTSV+"\n"+strings.Join([]string{
+		"3 ", "", "G-044325", "01749246-9617-585e-9e19-157ccad61ee2", "cold78_Defrost_status",
+		"Разморозка", "", "waiting", "100", "LOCAL", "cold78_status.Defrost_status",
+	}, "\t")), 0644))
+
+	stream, err := parser.Open(filePath, parser.Options{})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	// 3 строки данных пачками по 2: полная пачка, остаток, конец файла
+	batch, err := stream.Next(2)
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+	assert.Equal(t, 1, batch[0].Number)
+	assert.Equal(t, 4, batch[1].SourceRow)
+	assert.Equal(t, 4, stream.Rows())
+
+	batch, err = stream.Next(2)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+	assert.Equal(t, "G-044325", batch[0].Invid)
+	assert.Equal(t, "stream.tsv", batch[0].SourceFile)
+	assert.Equal(t, 5, stream.Rows())
+
+	_, err = stream.Next(2)
+	assert.ErrorIs(t, err, io.EOF)
+
+	// файл без строк данных отсекается при открытии
+	emptyPath := filepath.Join(t.TempDir(), "empty.tsv")
+	require.NoError(t, os.WriteFile(emptyPath, []byte(strings.SplitN(scannerTestTSV, "\n1 ", 2)[0]+"\n"), 0644))
+
+	_, err = parser.Parse(emptyPath)
+	assert.ErrorIs(t, err, parser.ErrNoMessages)
+
+	_, err = parser.Open(emptyPath, parser.Options{})
+	assert.ErrorIs(t, err, parser.ErrNoMessages)
+
+	// дело в содержимом - ParseError, повторять бесполезно; сбой чтения с диска - нет
+	var parseErr *parser.ParseError
+	assert.ErrorAs(t, err, &parseErr)
+
+	_, err = parser.Open(filepath.Join(t.TempDir(), "missing.tsv"), parser.Options{})
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &parseErr))
+}
+
+func TestHeaderColumnMapping(t *testing.T) {
+	// новая прошивка: колонка timestamp, другой порядок и свои имена колонок
+	content := strings.Join([]string{
+		"# выгрузка новой прошивки",
+		"timestamp\tunit_guid\tn\tdescription\tmsg_id\tclass\tlevel\tinvid",
+		"2026-01-15T10:00:00Z\t01749246-95f6-57db-b7c3-2ae0e8be671f\t7\tРазморозка\tcold7_Defrost_status\twaiting\t100\tG-044322",
+	}, "\n")
+
+	filePath := filepath.Join(t.TempDir(), "plant2_export.tsv")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	stream, err := parser.Open(filePath, parser.Options{
+		Columns: parser.Columns{parser.ColumnMessageText: {"Description"}},
+	})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	batch, err := stream.Next(10)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+
+	msg := batch[0]
+	assert.Equal(t, 7, msg.Number)
+	assert.Equal(t, "01749246-95f6-57db-b7c3-2ae0e8be671f", msg.UnitGUID)
+	assert.Equal(t, "cold7_Defrost_status", msg.MessageID)
+	assert.Equal(t, "Разморозка", msg.MessageText)
+	assert.Equal(t, "waiting", msg.MessageClass)
+	assert.Equal(t, 100, msg.Level)
+	assert.Equal(t, "G-044322", msg.Invid)
+	assert.Empty(t, msg.Address)
+
+	// без алиаса description не распознается, но файл все равно читается
+	plain, err := parser.Open(filePath, parser.Options{})
+	require.NoError(t, err)
+	defer plain.Close()
+
+	batch, err = plain.Next(10)
+	require.NoError(t, err)
+	assert.Empty(t, batch[0].MessageText)
+
+	// без unit_guid сообщения не к чему привязать
+	noGUID := filepath.Join(t.TempDir(), "no_guid.tsv")
+	require.NoError(t, os.WriteFile(noGUID, []byte("#\nn\tmsg_id\n1\tx\n"), 0644))
+
+	_, err = parser.Open(noGUID, parser.Options{})
+	assert.ErrorIs(t, err, parser.ErrMissingColumn)
+}
+
+func TestRowValidation(t *testing.T) {
+	header := strings.SplitN(scannerTestTSV, "\n1 ", 2)[0]
+	content := header + "\n" + strings.Join([]string{
+		"1\t\tG-044322\t01749246-95f6-57db-b7c3-2ae0e8be671f\tcold7_Defrost_status\tРазморозка\t\twaiting\t100\tLOCAL\taddr",
+		"2\t\tG-044322\tnot-a-guid\tcold7_VentSK_status\tВентилятор\t\tworking\t100\tLOCAL\taddr",
+		"3\t\tG-044322\t01749246-95f6-57db-b7c3-2ae0e8be671f\t\t\t\tbogus\thigh\t\t",
+		"4\t\tG-044325\t01749246-9617-585e-9e19-157ccad61ee2\tcold78_Defrost_status\tРазморозка\t\talarm\t100\tLOCAL\taddr",
+	}, "\n")
+
+	filePath := filepath.Join(t.TempDir(), "mixed.tsv")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	t.Run("lenient", func(t *testing.T) {
+		result, err := parser.Parse(filePath)
+		require.NoError(t, err)
+
+		require.Len(t, result.Messages, 2)
+		assert.Equal(t, 1, result.Messages[0].Number)
+		assert.Equal(t, 4, result.Messages[1].Number)
+
+		require.Len(t, result.Rejected, 2)
+		assert.Equal(t, 4, result.Rejected[0].Row)
+		assert.Contains(t, result.Rejected[0].Reason, "is not a UUID")
+		assert.Equal(t, "mixed.tsv", result.Rejected[0].FileName)
+		assert.Contains(t, result.Rejected[0].Content, "not-a-guid")
+
+		assert.Equal(t, 5, result.Rejected[1].Row)
+		assert.Contains(t, result.Rejected[1].Reason, "message_id is empty")
+		assert.Contains(t, result.Rejected[1].Reason, `unknown message class "bogus"`)
+		assert.Contains(t, result.Rejected[1].Reason, `level "high" is not an integer`)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		stream, err := parser.Open(filePath, parser.Options{Strict: true})
+		require.NoError(t, err)
+		defer stream.Close()
+
+		_, err = stream.Next(10)
+		assert.ErrorIs(t, err, parser.ErrInvalidRow)
+		assert.Contains(t, err.Error(), "line 4")
+	})
+}
+
+func TestEncodings(t *testing.T) {
+	encode := func(t *testing.T, enc encoding.Encoding) []byte {
+		data, err := enc.NewEncoder().Bytes([]byte(scannerTestTSV))
+		require.NoError(t, err)
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		encoding string
+		detected string
+	}{
+		{"utf-8", []byte(scannerTestTSV), "", parser.EncodingUTF8},
+		{"utf-8 with BOM", append([]byte("\uFEFF"), scannerTestTSV...), "", parser.EncodingUTF8},
+		{"windows-1251 detected", encode(t, charmap.Windows1251), "", parser.EncodingCP1251},
+		{"windows-1251 configured", encode(t, charmap.Windows1251), "windows-1251", parser.EncodingCP1251},
+		{"koi8-r configured", encode(t, charmap.KOI8R), "koi8-r", parser.EncodingKOI8R},
+		{"utf-16le with BOM", encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)), "", parser.EncodingUTF16LE},
+		{"utf-16be with BOM over config", encode(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM)), "koi8-r", parser.EncodingUTF16BE},
+		{"utf-16le without BOM", encode(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)), "", parser.EncodingUTF16LE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "data.tsv")
+			require.NoError(t, os.WriteFile(filePath, tt.data, 0644))
+
+			stream, err := parser.Open(filePath, parser.Options{Encoding: tt.encoding})
+			require.NoError(t, err)
+			defer stream.Close()
+
+			assert.Equal(t, tt.detected, stream.Encoding())
+
+			batch, err := stream.Next(10)
+			require.NoError(t, err)
+			require.Len(t, batch, 2)
+			assert.Equal(t, "Разморозка", batch[0].MessageText)
+			assert.Equal(t, "Вентилятор", batch[1].MessageText)
+			assert.Equal(t, "01749246-95f6-57db-b7c3-2ae0e8be671f", batch[1].UnitGUID)
+		})
+	}
+
+	_, err := parser.Open(filepath.Join("..", "..", "input_test", "data.tsv"), parser.Options{Encoding: "ebcdic"})
+	assert.ErrorIs(t, err, parser.ErrUnknownEncoding)
+}
+
+func TestEncodingDetectedPastSniffWindow(t *testing.T) {
+	// длинное ASCII-начало, кириллица в Windows-1251 только в последней строке
+	var data bytes.Buffer
+	data.WriteString("n\tmqtt\tinvid\tunit_guid\tmsg_id\ttext\tcontext\tclass\tlevel\tarea\taddr\n")
+	for i := 1; data.Len() < 3*4096; i++ {
+		fmt.Fprintf(&data, "%d\t\tG-044322\t01749246-95f6-57db-b7c3-2ae0e8be671f\tcold7_Defrost_status\tDefrost\t\twaiting\t100\tLOCAL\tcold7_status\n", i)
+	}
+	last, err := charmap.Windows1251.NewEncoder().String("0\t\tG-044322\t01749246-95f6-57db-b7c3-2ae0e8be671f\tcold7_VentSK_status\tВентилятор\t\tworking\t100\tLOCAL\tcold7_status\n")
+	require.NoError(t, err)
+	data.WriteString(last)
+
+	filePath := filepath.Join(t.TempDir(), "data.tsv")
+	require.NoError(t, os.WriteFile(filePath, data.Bytes(), 0644))
+
+	stream, err := parser.Open(filePath, parser.Options{})
+	require.NoError(t, err)
+	defer stream.Close()
+
+	var messages []models.DeviceMessage
+	for {
+		batch, err := stream.Next(100)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		messages = append(messages, batch...)
+	}
+
+	require.NotEmpty(t, messages)
+	assert.Equal(t, "Defrost", messages[0].MessageText)
+	assert.Equal(t, "Вентилятор", messages[len(messages)-1].MessageText)
+	assert.Equal(t, parser.EncodingCP1251, stream.Encoding())
+}
+
+func TestEncodingConfigValidation(t *testing.T) {
+	valid := config.ParserConfig{
+		Encoding: "auto",
+		Sources:  []config.SourceConfig{{Name: "plant2", Encoding: "Windows-1251"}, {Name: "default"}},
+	}
+	assert.NoError(t, valid.Validate())
+
+	// опечатка в конфиге ловится при старте, а не уводит каждый файл в карантин
+	typo := config.ParserConfig{Encoding: "windows1251"}
+	assert.ErrorIs(t, typo.Validate(), parser.ErrUnknownEncoding)
+
+	typo = config.ParserConfig{Sources: []config.SourceConfig{{Name: "plant2", Encoding: "cp-1251"}}}
+	err := typo.Validate()
+	assert.ErrorIs(t, err, parser.ErrUnknownEncoding)
+	assert.Contains(t, err.Error(), "plant2")
+}
+
+func TestInputFormats(t *testing.T) {
+	const guid = "01749246-95f6-57db-b7c3-2ae0e8be671f"
+
+	xlsx := excelize.NewFile()
+	require.NoError(t, xlsx.SetSheetRow("Sheet1", "A1", &[]any{"n", "unit_guid", "msg_id", "text", "class", "level"}))
+	require.NoError(t, xlsx.SetSheetRow("Sheet1", "A2", &[]any{1, guid, "cold7_Defrost_status", "Разморозка, этап 1", "waiting", 100}))
+	var xlsxData bytes.Buffer
+	require.NoError(t, xlsx.Write(&xlsxData))
+
+	tests := []struct {
+		name   string
+		file   string
+		data   []byte
+		format string
+	}{
+		{
+			name: "csv with comma",
+			file: "export.csv",
+			data: []byte("n,unit_guid,msg_id,text,class,level\n" +
+				"1," + guid + `,cold7_Defrost_status,"Разморозка, этап 1",waiting,100` + "\n"),
+			format: "csv",
+		},
+		{
+			name: "csv with semicolon",
+			file: "export.csv",
+			data: []byte("#номер;гуид;id;текст;класс;уровень\n" +
+				"n;unit_guid;msg_id;text;class;level\n" +
+				"1;" + guid + ";cold7_Defrost_status;Разморозка, этап 1;waiting;100\n"),
+			format: "csv",
+		},
+		{
+			name:   "json lines",
+			file:   "export.jsonl",
+			data:   []byte(`{"number": 1, "unit_guid": "` + guid + `", "message_id": "cold7_Defrost_status", "message_text": "Разморозка, этап 1", "message_class": "waiting", "level": 100}` + "\n\n"),
+			format: "jsonl",
+		},
+		{
+			name:   "xlsx",
+			file:   "export.xlsx",
+			data:   xlsxData.Bytes(),
+			format: "xlsx",
+		},
+		{
+			name:   "json lines sniffed by content",
+			file:   "export.dat",
+			data:   []byte(`{"number": 1, "unit_guid": "` + guid + `", "message_id": "cold7_Defrost_status", "message_text": "Разморозка, этап 1", "message_class": "waiting", "level": "100"}`),
+			format: "jsonl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := parser.NewStream(bytes.NewReader(tt.data), tt.file, parser.Options{})
+			require.NoError(t, err)
+			defer stream.Close()
+
+			assert.Equal(t, tt.format, stream.Format())
+
+			batch, err := stream.Next(10)
+			require.NoError(t, err)
+			require.Len(t, batch, 1)
+
+			msg := batch[0]
+			assert.Equal(t, 1, msg.Number)
+			assert.Equal(t, guid, msg.UnitGUID)
+			assert.Equal(t, "cold7_Defrost_status", msg.MessageID)
+			assert.Equal(t, "Разморозка, этап 1", msg.MessageText)
+			assert.Equal(t, "waiting", msg.MessageClass)
+			assert.Equal(t, 100, msg.Level)
+			assert.Equal(t, tt.file, msg.SourceFile)
+		})
+	}
+
+	// битая строка JSON Lines отклоняется, остальные читаются
+	filePath := filepath.Join(t.TempDir(), "broken.jsonl")
+	require.NoError(t, os.WriteFile(filePath, []byte(`{"unit_guid": "`+guid+`", "message_id": "a", "message_class": "alarm", "level": 1}`+"\n{broken\n"), 0644))
+
+	result, err := parser.Parse(filePath)
+	require.NoError(t, err)
+	assert.Len(t, result.Messages, 1)
+	require.Len(t, result.Rejected, 1)
+	assert.Equal(t, 2, result.Rejected[0].Row)
+
+	assert.True(t, parser.Supported("data.csv.gz"))
+	assert.False(t, parser.Supported("notes.txt"))
+	assert.False(t, parser.Supported("export"))
+	assert.False(t, parser.Supported("LICENSE"))
+}
@@ -0,0 +1,267 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/config"
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/repository/postgres"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabase - БД для интеграционных тестов, схема уже накатана миграциями
+var testDatabase = config.DatabaseConfig{
+	Host:     "localhost",
+	Port:     5432,
+	User:     "postgres",
+	Password: "postgres",
+	Name:     "reporting-service",
+	SSLMode:  "disable",
+}
+
+// newPostgresTestRepo - репозиторий на тестовой БД с очищенными таблицами. Проверяет то, что
+// memoryRepo не покрывает: блокировки, ON CONFLICT и сроки аренды в SQL. С -short пропускается
+func newPostgresTestRepo(t *testing.T) (*postgres.Repository, *pgxpool.Pool) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping postgres test")
+	}
+
+	pool, err := postgres.NewPool(&config.Config{Database: testDatabase})
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	truncate := func() {
+		for _, table := range []string{"device_messages", "processed_files", "jobs"} {
+			_, err := pool.Exec(context.Background(), "TRUNCATE "+table+" CASCADE")
+			require.NoError(t, err)
+		}
+	}
+	truncate()
+	t.Cleanup(truncate)
+
+	return postgres.New(pool), pool
+}
+
+func TestPostgresReapExpiredLeases(t *testing.T) {
+	repo, _ := newPostgresTestRepo(t)
+	ctx := context.Background()
+
+	_, err := repo.StartFileAttempt(ctx, "expired.tsv", "worker-1", time.Millisecond)
+	require.NoError(t, err)
+	_, err = repo.StartFileAttempt(ctx, "alive.tsv", "worker-2", time.Hour)
+	require.NoError(t, err)
+	// processing без аренды: упал до первой попытки
+	require.NoError(t, repo.UpdateFileStatus(ctx, "stale.tsv", models.StatusProcessing, ""))
+	// файл из zip перезагружается вместе с архивом, реапер его не трогает
+	require.NoError(t, repo.RegisterArchiveEntry(ctx, "bundle.zip/a.tsv", "bundle.zip"))
+
+	time.Sleep(50 * time.Millisecond)
+
+	reaped, err := repo.ReapExpiredLeases(ctx, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"expired.tsv", "stale.tsv"}, reaped)
+
+	for fileName, status := range map[string]string{
+		"expired.tsv":      models.StatusQueued,
+		"stale.tsv":        models.StatusQueued,
+		"alive.tsv":        models.StatusProcessing,
+		"bundle.zip/a.tsv": models.StatusProcessing,
+	} {
+		f, err := repo.GetProcessedFile(ctx, fileName)
+		require.NoError(t, err)
+		assert.Equal(t, status, f.Status, fileName)
+	}
+
+	// воркер, у которого забрали файл, узнает об этом на следующем heartbeat
+	assert.ErrorIs(t, repo.HeartbeatFile(ctx, "expired.tsv", "worker-1", time.Hour), models.ErrLeaseLost)
+	assert.NoError(t, repo.HeartbeatFile(ctx, "alive.tsv", "worker-2", time.Hour))
+
+	// повторный проход ничего не находит
+	reaped, err = repo.ReapExpiredLeases(ctx, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Empty(t, reaped)
+}
+
+// claimConcurrently - одновременно забирает файл workers воркерами, возвращает число успешных
+func claimConcurrently(t *testing.T, repo *postgres.Repository, fileName string, workers int) int {
+	t.Helper()
+
+	var (
+		start   = make(chan struct{})
+		wg      sync.WaitGroup
+		claimed atomic.Int32
+	)
+
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			ok, _, err := repo.ClaimFile(context.Background(), fileName, "hash", fmt.Sprintf("worker-%d", i), time.Hour)
+			assert.NoError(t, err)
+			if ok {
+				claimed.Add(1)
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	return int(claimed.Load())
+}
+
+func TestPostgresClaimFileConcurrent(t *testing.T) {
+	repo, _ := newPostgresTestRepo(t)
+	ctx := context.Background()
+
+	// записи еще нет: вставки сталкиваются на ON CONFLICT
+	assert.Equal(t, 1, claimConcurrently(t, repo, "new.tsv", 8))
+
+	// запись есть и ее можно брать: строку блокирует один, остальные ее пропускают (SKIP LOCKED)
+	require.NoError(t, repo.UpdateFileStatus(ctx, "queued.tsv", models.StatusQueued, ""))
+	assert.Equal(t, 1, claimConcurrently(t, repo, "queued.tsv", 8))
+
+	f, err := repo.GetProcessedFile(ctx, "queued.tsv")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusProcessing, f.Status)
+	assert.NotEmpty(t, f.WorkerID)
+
+	// пока аренда действует, файл больше никому не достается
+	assert.Equal(t, 0, claimConcurrently(t, repo, "queued.tsv", 4))
+}
+
+func TestPostgresJobQueue(t *testing.T) {
+	repo, pool := newPostgresTestRepo(t)
+	ctx := context.Background()
+
+	// на файл одно задание: повторная постановка только поднимает приоритет и force
+	require.NoError(t, repo.EnqueueJob(ctx, "data.tsv", models.PriorityNormal, false))
+	require.NoError(t, repo.EnqueueJob(ctx, "data.tsv", models.PriorityHigh, true))
+	require.NoError(t, repo.EnqueueJob(ctx, "data.tsv", models.PriorityNormal, false))
+
+	var count int
+	require.NoError(t, pool.QueryRow(ctx, "SELECT COUNT(*) FROM jobs").Scan(&count))
+	assert.Equal(t, 1, count)
+
+	// одновременно задание достается одному воркеру
+	var (
+		start = make(chan struct{})
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		got   []*models.Job
+	)
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			job, err := repo.DequeueJob(ctx, fmt.Sprintf("worker-%d", i), 500*time.Millisecond)
+			assert.NoError(t, err)
+			if job != nil {
+				mu.Lock()
+				got = append(got, job)
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	require.Len(t, got, 1)
+	job := got[0]
+	assert.Equal(t, "data.tsv", job.FileName)
+	assert.Equal(t, models.PriorityHigh, job.Priority)
+	assert.True(t, job.Force)
+	assert.Equal(t, 1, job.Attempts)
+
+	// пока задание скрыто, его никто не видит
+	other, err := repo.DequeueJob(ctx, "worker-other", time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, other)
+
+	// воркер не продлил видимость - задание снова выдается, старый воркер его потерял
+	time.Sleep(600 * time.Millisecond)
+
+	other, err = repo.DequeueJob(ctx, "worker-other", time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, other)
+	assert.Equal(t, job.ID, other.ID)
+	assert.Equal(t, 2, other.Attempts)
+	assert.ErrorIs(t, repo.ExtendJob(ctx, job.ID, job.LockedBy, time.Hour), models.ErrLeaseLost)
+
+	// отложенное задание не выдается до next_run_at
+	require.NoError(t, repo.ReleaseJob(ctx, other.ID, "worker-other", time.Now().Add(time.Hour), "retry later"))
+	next, err := repo.DequeueJob(ctx, "worker-other", time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, next)
+
+	// force поднимает отложенное задание сразу
+	require.NoError(t, repo.EnqueueJob(ctx, "data.tsv", models.PriorityHigh, true))
+	next, err = repo.DequeueJob(ctx, "worker-other", time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, next)
+
+	require.NoError(t, repo.CompleteJob(ctx, next.ID, "worker-other"))
+	require.NoError(t, pool.QueryRow(ctx, "SELECT COUNT(*) FROM jobs").Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestPostgresAbortFileAttempt(t *testing.T) {
+	repo, _ := newPostgresTestRepo(t)
+	ctx := context.Background()
+
+	attempt, err := repo.StartFileAttempt(ctx, "data.tsv", "worker-1", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 1, attempt)
+
+	// чужой воркер попытку не откатит
+	assert.ErrorIs(t, repo.AbortFileAttempt(ctx, "data.tsv", "worker-2"), models.ErrLeaseLost)
+
+	require.NoError(t, repo.AbortFileAttempt(ctx, "data.tsv", "worker-1"))
+
+	f, err := repo.GetProcessedFile(ctx, "data.tsv")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusQueued, f.Status)
+	assert.Zero(t, f.Attempts)
+	assert.Empty(t, f.WorkerID)
+	assert.Nil(t, f.LeaseExpiresAt)
+}
+
+func TestPostgresIngestKeepsCreatedAt(t *testing.T) {
+	repo, pool := newPostgresTestRepo(t)
+	ctx := context.Background()
+
+	const unitGUID = "01749246-960c-5832-b2aa-ed2b4da5e137"
+	messages := []models.DeviceMessage{
+		{Number: 1, UnitGUID: unitGUID, MessageClass: "alarm", SourceRow: 2},
+	}
+
+	_, err := repo.IngestFile(ctx, "data.tsv", models.BatchOf(messages), nil)
+	require.NoError(t, err)
+
+	// файл загружен месяц назад
+	firstIngested := time.Now().AddDate(0, -1, 0).Truncate(time.Microsecond)
+	_, err = pool.Exec(ctx, "UPDATE device_messages SET created_at = $1 WHERE source_file = $2", firstIngested, "data.tsv")
+	require.NoError(t, err)
+
+	// повторная обработка не переносит сообщения в сегодня
+	_, err = repo.IngestFile(ctx, "data.tsv", models.BatchOf(messages), nil)
+	require.NoError(t, err)
+
+	got, err := repo.GetMessagesByUnitGUID(ctx, unitGUID, models.MessageFilter{To: firstIngested.Add(time.Second)})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.True(t, got[0].CreatedAt.Equal(firstIngested))
+}
@@ -0,0 +1,194 @@
+package test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestPDFRenderer(t *testing.T) {
+	// Сообщений больше, чем влезает на одну страницу, с длинными текстами
+	var messages []models.DeviceMessage
+	for i := 1; i <= 120; i++ {
+		messages = append(messages, models.DeviceMessage{
+			Number:       i,
+			Invid:        "G-044322",
+			UnitGUID:     "01749246-95f6-57db-b7c3-2ae0e8be671f",
+			MessageID:    fmt.Sprintf("cold7_status_%d", i),
+			MessageText:  strings.Repeat("Разморозка испарителя ", i%4+1),
+			MessageClass: "waiting",
+			Level:        100,
+			Address:      "cold7_status.Defrost_status_with_a_very_long_address",
+		})
+	}
+
+	renderer := report.NewPDFRenderer("../../fonts")
+	assert.Equal(t, "pdf", renderer.Extension())
+	assert.Equal(t, "application/pdf", renderer.ContentType())
+
+	device := report.NewDevice("01749246-95f6-57db-b7c3-2ae0e8be671f", messages)
+	assert.Equal(t, "G-044322", device.Invid)
+
+	data, err := renderer.Render(device, messages)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("%PDF")))
+
+	// Все сообщения в отчете, значит страниц больше одной
+	pages := bytes.Count(data, []byte("/Type /Page\n"))
+	assert.Greater(t, pages, 1)
+}
+
+func TestPDFRendererOversizedRow(t *testing.T) {
+	// текст одного сообщения длиннее страницы: строка режется по страницам, а не рисуется поверх подвала
+	messages := []models.DeviceMessage{{
+		Number:       1,
+		UnitGUID:     "01749246-95f6-57db-b7c3-2ae0e8be671f",
+		MessageText:  strings.Repeat("Разморозка испарителя ", 500),
+		MessageClass: "waiting",
+	}}
+
+	data, err := report.NewPDFRenderer("../../fonts").Render(report.Device{UnitGUID: messages[0].UnitGUID}, messages)
+	require.NoError(t, err)
+
+	pages := bytes.Count(data, []byte("/Type /Page\n"))
+	assert.GreaterOrEqual(t, pages, 4)
+}
+
+func TestPDFRendererMissingFonts(t *testing.T) {
+	_, err := report.NewPDFRenderer("no-such-dir").Render(report.Device{UnitGUID: "x"}, nil)
+	assert.Error(t, err)
+}
+
+func TestHTMLRenderer(t *testing.T) {
+	messages := []models.DeviceMessage{
+		{Number: 1, Invid: "G-044322", MessageText: "Разморозка <b>", MessageClass: "alarm", Level: 100, Address: "cold7_status.Defrost_status"},
+		{Number: 2, Invid: "G-044322", MessageText: "Вентилятор", MessageClass: "working", Level: 50, Address: "cold7_status.VentSK_status"},
+	}
+
+	renderer, err := report.NewRenderer(report.FormatHTML, "")
+	require.NoError(t, err)
+	assert.Equal(t, "html", renderer.Extension())
+
+	data, err := renderer.Render(report.NewDevice("01749246-95f6-57db-b7c3-2ae0e8be671f", messages), messages)
+	require.NoError(t, err)
+
+	html := string(data)
+	assert.Contains(t, html, "Unit GUID: 01749246-95f6-57db-b7c3-2ae0e8be671f")
+	assert.Contains(t, html, "Инвентарный номер: G-044322")
+	assert.Contains(t, html, `class="class-alarm"`)
+	assert.Contains(t, html, `class="class-working"`)
+	// текст сообщений экранируется
+	assert.Contains(t, html, "Разморозка &lt;b&gt;")
+
+	_, err = report.NewRenderer("docx", "")
+	assert.Error(t, err)
+}
+
+func TestSpreadsheetExport(t *testing.T) {
+	createdAt := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	messages := []models.DeviceMessage{
+		{Number: 1, Invid: "G-044322", UnitGUID: "01749246-95f6-57db-b7c3-2ae0e8be671f", MessageID: "cold7_Defrost_status", MessageText: "Разморозка", MessageClass: "waiting", Level: 100, Area: "LOCAL", Address: "cold7_status.Defrost_status", SourceFile: "data.tsv", SourceRow: 3, CreatedAt: createdAt},
+		{Number: 2, Invid: "G-044322", UnitGUID: "01749246-95f6-57db-b7c3-2ae0e8be671f", MessageID: "cold7_VentSK_status", MessageText: "Вентилятор", MessageClass: "working", Level: 100, Area: "LOCAL", Address: "cold7_status.VentSK_status", SourceFile: "data.tsv", CreatedAt: createdAt},
+		{Number: 3, Invid: "G-044322", UnitGUID: "01749246-95f6-57db-b7c3-2ae0e8be671f", MessageID: "cold7_Alarm", MessageText: "Авария", MessageClass: "working", Level: 1, Area: "LOCAL", Address: "cold7_status.Alarm", SourceFile: "data.tsv", CreatedAt: createdAt},
+	}
+	device := report.NewDevice("01749246-95f6-57db-b7c3-2ae0e8be671f", messages)
+
+	t.Run("csv", func(t *testing.T) {
+		data, err := report.NewCSVRenderer().Render(device, messages)
+		require.NoError(t, err)
+
+		records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\uFEFF")))).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		assert.Len(t, records[0], 14)
+		assert.Equal(t, "source_file", records[0][11])
+		assert.Equal(t, []string{
+			"1", "", "G-044322", "01749246-95f6-57db-b7c3-2ae0e8be671f", "cold7_Defrost_status", "Разморозка",
+			"", "waiting", "100", "LOCAL", "cold7_status.Defrost_status", "data.tsv", "3", "2026-01-15T10:30:00Z",
+		}, records[1])
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		data, err := report.NewXLSXRenderer().Render(device, messages)
+		require.NoError(t, err)
+
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		defer f.Close()
+
+		rows, err := f.GetRows("Сообщения")
+		require.NoError(t, err)
+		require.Len(t, rows, 4)
+		assert.Equal(t, "Вентилятор", rows[2][5])
+
+		summary, err := f.GetRows("Сводка")
+		require.NoError(t, err)
+		assert.Contains(t, summary, []string{"waiting", "1"})
+		assert.Contains(t, summary, []string{"working", "2"})
+		assert.Contains(t, summary, []string{"1", "1"})
+		assert.Contains(t, summary, []string{"100", "2"})
+	})
+
+	// текст от устройства не должен выполняться в Excel как формула
+	t.Run("formulas", func(t *testing.T) {
+		evil := []models.DeviceMessage{{
+			Number: 1, Invid: "@SUM(A1)", UnitGUID: "01749246-95f6-57db-b7c3-2ae0e8be671f",
+			MessageText: `=HYPERLINK("http://evil","x")`, Context: "+1", Address: "-2", MessageClass: "alarm",
+		}}
+
+		data, err := report.NewCSVRenderer().Render(device, evil)
+		require.NoError(t, err)
+		records, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\uFEFF")))).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "'@SUM(A1)", records[1][2])
+		assert.Equal(t, `'=HYPERLINK("http://evil","x")`, records[1][5])
+		assert.Equal(t, "'+1", records[1][6])
+		assert.Equal(t, "'-2", records[1][10])
+		assert.Equal(t, "alarm", records[1][7])
+
+		data, err = report.NewXLSXRenderer().Render(device, evil)
+		require.NoError(t, err)
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		defer f.Close()
+
+		// в XLSX строки остаются текстом без формул, значения совпадают с БД
+		formula, err := f.GetCellFormula("Сообщения", "F2")
+		require.NoError(t, err)
+		assert.Empty(t, formula)
+		for cell, want := range map[string]string{
+			"C2": "@SUM(A1)",
+			"F2": `=HYPERLINK("http://evil","x")`,
+			"G2": "+1",
+			"K2": "-2",
+		} {
+			value, err := f.GetCellValue("Сообщения", cell)
+			require.NoError(t, err)
+			assert.Equal(t, want, value, cell)
+		}
+	})
+
+	// отрицательные по виду значения в XLSX читаются обратно как есть
+	t.Run("xlsx negative values", func(t *testing.T) {
+		data, err := report.NewXLSXRenderer().Render(device, []models.DeviceMessage{{
+			Number: 1, UnitGUID: "01749246-95f6-57db-b7c3-2ae0e8be671f", Context: "-5", MessageClass: "alarm",
+		}})
+		require.NoError(t, err)
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		defer f.Close()
+
+		value, err := f.GetCellValue("Сообщения", "G2")
+		require.NoError(t, err)
+		assert.Equal(t, "-5", value)
+	})
+}
@@ -0,0 +1,698 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/config"
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/alonsoF100/reporting-service/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const scannerTestTSV = `#номер	mqtt	инвентарный	гуид	id сообщения	текст сообщения	среда	классс сообщения	уровень сообщения	Зона переменных	адрес переменной
+n 	mqtt	invid   	unit_guid                           	msg_id                   	text               	context	class  	level	area 	addr                                 
+1 	    	G-044322	01749246-95f6-57db-b7c3-2ae0e8be671f	cold7_Defrost_status     	Разморозка         	       	waiting	100  	LOCAL	cold7_status.Defrost_status
+2 	    	G-044322	01749246-95f6-57db-b7c3-2ae0e8be671f	cold7_VentSK_status      	Вентилятор         	       	working	100  	LOCAL	cold7_status.VentSK_status`
+
+func newScannerTestConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		Application: config.ApplicationConfig{
+			Input:      t.TempDir(),
+			Output:     t.TempDir(),
+			Period:     time.Hour, // периодический скан не должен успеть сработать
+			Workers:    1,
+			Watch:      true,
+			WatchDelay: 100 * time.Millisecond,
+		},
+		Retry: config.RetryConfig{
+			MaxAttempts: 1,
+		},
+	}
+}
+
+func TestScannerWatch(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	repo := newMemoryRepo()
+	scanner := service.NewScanner(cfg, repo, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scanner.Start(ctx)
+
+	// даем вотчеру подписаться на папку
+	time.Sleep(200 * time.Millisecond)
+
+	err := os.WriteFile(filepath.Join(cfg.Application.Input, "watched.tsv"), []byte(scannerTestTSV), 0644)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return repo.status("watched.tsv") == models.StatusProcessed
+	}, 3*time.Second, 50*time.Millisecond, "file should be picked up by watcher before the next scan")
+
+	messages, err := repo.GetAllMessagesByUnitGUID(ctx, "01749246-95f6-57db-b7c3-2ae0e8be671f")
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+}
+
+func TestScannerStabilityWindow(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.StabilityWindow = 300 * time.Millisecond
+	repo := newMemoryRepo()
+	scanner := service.NewScanner(cfg, repo, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scanner.Start(ctx)
+	time.Sleep(200 * time.Millisecond)
+
+	// файл дописывается частями, пока он растет - в очередь не попадает
+	path := filepath.Join(cfg.Application.Input, "growing.tsv")
+	half := len(scannerTestTSV) / 2
+	require.NoError(t, os.WriteFile(path, []byte(scannerTestTSV[:half]), 0644))
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(150 * time.Millisecond)
+		assert.Empty(t, repo.status("growing.tsv"), "file is still being written")
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = f.WriteString(" ")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(scannerTestTSV[half:])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.Eventually(t, func() bool {
+		return repo.status("growing.tsv") == models.StatusProcessed
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestScannerReadyMarker(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.ReadyMarkers = true
+	repo := newMemoryRepo()
+	scanner := service.NewScanner(cfg, repo, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scanner.Start(ctx)
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "marked.tsv"), []byte(scannerTestTSV), 0644))
+
+	time.Sleep(500 * time.Millisecond)
+	assert.Empty(t, repo.status("marked.tsv"), "file without marker must wait")
+
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "marked.tsv.done"), nil, 0644))
+
+	require.Eventually(t, func() bool {
+		return repo.status("marked.tsv") == models.StatusProcessed
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestScannerArchiveAndQuarantine(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.Archive = t.TempDir()
+	cfg.Application.Quarantine = t.TempDir()
+	cfg.Application.ArchiveGzip = true
+	cfg.Retry.MaxAttempts = 3
+	repo := newMemoryRepo()
+	scanner := service.NewScanner(cfg, repo, nil)
+
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "good.tsv"), []byte(scannerTestTSV), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "broken.tsv"), []byte("only header\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scanner.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return repo.status("good.tsv") == models.StatusProcessed && repo.status("broken.tsv") == models.StatusFailed
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// обработанный файл сжат в папку с датой
+	archived := filepath.Join(cfg.Application.Archive, time.Now().Format(time.DateOnly), "good.tsv.gz")
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(archived)
+		return err == nil
+	}, time.Second, 50*time.Millisecond)
+
+	// сломанный файл в карантине с описанием ошибки
+	quarantined := filepath.Join(cfg.Application.Quarantine, "broken.tsv")
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(quarantined + ".error.json")
+		return err == nil
+	}, time.Second, 50*time.Millisecond)
+	assert.FileExists(t, quarantined)
+
+	data, err := os.ReadFile(quarantined + ".error.json")
+	require.NoError(t, err)
+
+	var report struct {
+		FileName string `json:"file_name"`
+		Error    string `json:"error"`
+		Category string `json:"category"`
+		Attempts int    `json:"attempts"`
+	}
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, "broken.tsv", report.FileName)
+	assert.NotEmpty(t, report.Error)
+
+	// битый файл не повторяется, хотя попыток разрешено больше
+	assert.Equal(t, models.ErrorPermanent, report.Category)
+	assert.Equal(t, 1, report.Attempts)
+	assert.Equal(t, 1, repo.processedFile("broken.tsv").Attempts)
+	assert.Equal(t, models.ErrorPermanent, repo.processedFile("broken.tsv").ErrorCategory)
+
+	// в input ничего не осталось
+	entries, err := os.ReadDir(cfg.Application.Input)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestScannerDeduplication(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.Watch = false
+	repo := newMemoryRepo()
+	scanner := service.NewScanner(cfg, repo, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < cfg.Application.Workers; i++ {
+		go scanner.Worker(ctx, i)
+	}
+
+	scanAndWait := func(fileName, status string) {
+		t.Helper()
+		scanner.Scan(ctx)
+		require.Eventually(t, func() bool {
+			return repo.status(fileName) == status
+		}, 3*time.Second, 20*time.Millisecond)
+	}
+
+	first := filepath.Join(cfg.Application.Input, "first.tsv")
+	require.NoError(t, os.WriteFile(first, []byte(scannerTestTSV), 0644))
+	scanAndWait("first.tsv", models.StatusProcessed)
+	assert.Equal(t, 2, repo.messageCount())
+
+	// то же содержимое под другим именем не загружается второй раз
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "copy.tsv"), []byte(scannerTestTSV), 0644))
+	scanAndWait("copy.tsv", models.StatusDuplicate)
+	assert.Equal(t, "first.tsv", repo.processedFile("copy.tsv").DuplicateOf)
+	assert.Equal(t, 2, repo.messageCount())
+
+	// исправленный файл под тем же именем - новая ревизия
+	fixed := strings.Replace(scannerTestTSV, "Разморозка", "Оттайка", 1)
+	require.NoError(t, os.WriteFile(first, []byte(fixed), 0644))
+	require.NoError(t, os.Chtimes(first, time.Now(), time.Now().Add(time.Second)))
+	require.NoError(t, repo.UpdateFileStatus(ctx, "first.tsv", models.StatusProcessed, ""))
+
+	scanner.Scan(ctx)
+	require.Eventually(t, func() bool {
+		f := repo.processedFile("first.tsv")
+		return f.Revision == 2 && f.Status == models.StatusProcessed
+	}, 3*time.Second, 20*time.Millisecond)
+
+	// сообщения прежней ревизии заменены, а не задублированы
+	messages, err := repo.GetAllMessagesByUnitGUID(ctx, "01749246-95f6-57db-b7c3-2ae0e8be671f")
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "Оттайка", messages[0].MessageText)
+}
+
+func TestScannerRejectedRows(t *testing.T) {
+	badRow := "3 \t\tG-044322\tnot-a-guid\tcold7_Defrost_status\tРазморозка\t\twaiting\t100\tLOCAL\taddr"
+	content := []byte(scannerTestTSV + "\n" + badRow)
+
+	run := func(t *testing.T, strict bool) *memoryRepo {
+		cfg := newScannerTestConfig(t)
+		cfg.Parser.Strict = strict
+		repo := newMemoryRepo()
+		scanner := service.NewScanner(cfg, repo, nil)
+
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "data.tsv"), content, 0644))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go scanner.Start(ctx)
+
+		require.Eventually(t, func() bool {
+			status := repo.status("data.tsv")
+			return status == models.StatusProcessed || status == models.StatusFailed
+		}, 3*time.Second, 50*time.Millisecond)
+
+		return repo
+	}
+
+	// в мягком режиме файл загружается без битой строки, а она сохраняется с причиной
+	t.Run("lenient", func(t *testing.T) {
+		repo := run(t, false)
+
+		assert.Equal(t, models.StatusProcessed, repo.status("data.tsv"))
+		assert.Equal(t, 2, repo.messageCount())
+
+		rejected := repo.rejectedRows("data.tsv")
+		require.Len(t, rejected, 1)
+		assert.Equal(t, 5, rejected[0].Row)
+		assert.Contains(t, rejected[0].Reason, "not a UUID")
+	})
+
+	// сохраняются только первые отклоненные строки, но счетчик считает все
+	t.Run("many rejected", func(t *testing.T) {
+		cfg := newScannerTestConfig(t)
+		repo := newMemoryRepo()
+		scanner := service.NewScanner(cfg, repo, nil)
+
+		many := scannerTestTSV + strings.Repeat("\n"+badRow, 1200)
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "many.tsv"), []byte(many), 0644))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go scanner.Start(ctx)
+
+		require.Eventually(t, func() bool {
+			return repo.status("many.tsv") == models.StatusProcessed
+		}, 3*time.Second, 50*time.Millisecond)
+
+		assert.Len(t, repo.rejectedRows("many.tsv"), 1000)
+		assert.Equal(t, 1200, repo.processedFile("many.tsv").RejectedCount)
+	})
+
+	// в строгом режиме тот же файл целиком уходит в ошибку
+	t.Run("strict", func(t *testing.T) {
+		repo := run(t, true)
+
+		assert.Equal(t, models.StatusFailed, repo.status("data.tsv"))
+		assert.Zero(t, repo.messageCount())
+	})
+}
+
+func TestScannerCompressedInputs(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.Archive = t.TempDir()
+	cfg.Application.ArchiveGzip = true
+	repo := newMemoryRepo()
+	scanner := service.NewScanner(cfg, repo, nil)
+
+	// .tsv.gz
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write([]byte(scannerTestTSV))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "site1.tsv.gz"), gz.Bytes(), 0644))
+
+	// без расширения - посторонний файл, не берется даже с данными внутри
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "site2"), []byte(scannerTestTSV), 0644))
+
+	// .zip с двумя TSV (один в папке) и посторонним файлом
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for name, content := range map[string]string{
+		"a.tsv":       scannerTestTSV,
+		"plant/b.tsv": strings.Replace(scannerTestTSV, "cold7_Defrost_status", "cold9_Defrost_status", 1),
+		"readme.txt":  "not a tsv",
+		"LICENSE":     "not a tsv, not a csv",
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "bundle.zip"), zipped.Bytes(), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scanner.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return repo.status("site1.tsv.gz") == models.StatusProcessed &&
+			repo.status("bundle.zip") == models.StatusProcessed
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// каждый TSV из архива отслеживается отдельно со ссылкой на архив
+	for _, entry := range []string{"bundle.zip/a.tsv", "bundle.zip/plant/b.tsv"} {
+		f := repo.processedFile(entry)
+		assert.Equal(t, models.StatusProcessed, f.Status, entry)
+		assert.Equal(t, "bundle.zip", f.ArchivePath, entry)
+	}
+
+	assert.Equal(t, map[string]int{
+		"site1.tsv.gz":           2,
+		"bundle.zip/a.tsv":       2,
+		"bundle.zip/plant/b.tsv": 2,
+	}, repo.sourceFiles())
+
+	// файл без расширения не тронут
+	assert.Empty(t, repo.status("site2"))
+	assert.FileExists(t, filepath.Join(cfg.Application.Input, "site2"))
+
+	// уже сжатые файлы архивируются как есть, без второго .gz
+	dir := filepath.Join(cfg.Application.Archive, time.Now().Format(time.DateOnly))
+	require.Eventually(t, func() bool {
+		_, errGz := os.Stat(filepath.Join(dir, "site1.tsv.gz"))
+		_, errZip := os.Stat(filepath.Join(dir, "bundle.zip"))
+		return errGz == nil && errZip == nil
+	}, time.Second, 50*time.Millisecond)
+}
+
+func TestScannerRejectsUnsafeZipEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+	}{
+		{"parent directory", []string{"a.tsv", "../data.tsv"}},
+		{"absolute path", []string{"a.tsv", "/data.tsv"}},
+		{"backslash", []string{"a.tsv", `..\data.tsv`}},
+		{"duplicate", []string{"a.tsv", "a.tsv"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newScannerTestConfig(t)
+			cfg.Application.Quarantine = t.TempDir()
+			repo := newMemoryRepo()
+			scanner := service.NewScanner(cfg, repo, nil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go scanner.Start(ctx)
+
+			// настоящий файл, который архив пытается перезаписать
+			require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "data.tsv"), []byte(scannerTestTSV), 0644))
+			require.Eventually(t, func() bool {
+				return repo.status("data.tsv") == models.StatusProcessed
+			}, 3*time.Second, 50*time.Millisecond)
+			before := repo.processedFile("data.tsv")
+
+			var zipped bytes.Buffer
+			zw := zip.NewWriter(&zipped)
+			for _, name := range tt.entries {
+				w, err := zw.CreateHeader(&zip.FileHeader{Name: name})
+				require.NoError(t, err)
+				_, err = w.Write([]byte(strings.Replace(scannerTestTSV, "Разморозка", "Подмена", 1)))
+				require.NoError(t, err)
+			}
+			require.NoError(t, zw.Close())
+			require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "evil.zip"), zipped.Bytes(), 0644))
+
+			require.Eventually(t, func() bool {
+				return repo.status("evil.zip") == models.StatusFailed
+			}, 3*time.Second, 50*time.Millisecond)
+
+			// из архива ничего не загружено, строка и сообщения data.tsv не тронуты
+			assert.Equal(t, models.ErrorPermanent, repo.processedFile("evil.zip").ErrorCategory)
+			assert.Equal(t, before, repo.processedFile("data.tsv"))
+			assert.Equal(t, map[string]int{"data.tsv": 2}, repo.sourceFiles())
+			repo.mu.Lock()
+			for _, msg := range repo.messages {
+				assert.NotEqual(t, "Подмена", msg.MessageText)
+			}
+			repo.mu.Unlock()
+
+			require.Eventually(t, func() bool {
+				_, err := os.Stat(filepath.Join(cfg.Application.Quarantine, "evil.zip.error.json"))
+				return err == nil
+			}, time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+func TestScannerReapsExpiredLease(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.Watch = false
+	cfg.Application.LeaseDuration = time.Second
+	repo := newMemoryRepo()
+
+	// файл остался в processing после падения экземпляра, аренда давно истекла
+	expired := time.Now().Add(-time.Hour)
+	repo.files["stuck.tsv"] = &models.ProcessedFile{
+		FileName:       "stuck.tsv",
+		Status:         models.StatusProcessing,
+		Revision:       1,
+		Attempts:       1,
+		WorkerID:       "crashed-1/0",
+		LeaseExpiresAt: &expired,
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "stuck.tsv"), []byte(scannerTestTSV), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.NewScanner(cfg, repo, nil).Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return repo.status("stuck.tsv") == models.StatusProcessed
+	}, 3*time.Second, 50*time.Millisecond)
+
+	file := repo.processedFile("stuck.tsv")
+	assert.Equal(t, 2, file.Attempts)
+	assert.Empty(t, file.WorkerID, "lease is released when processing ends")
+	assert.Nil(t, file.LeaseExpiresAt)
+	assert.Equal(t, 2, repo.messageCount())
+}
+
+func TestScannerReplicasClaimOnce(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.Watch = false
+	repo := newMemoryRepo()
+
+	// у каждого файла свое содержимое, чтобы дедупликация не мешала
+	var names []string
+	for i := 0; i < 6; i++ {
+		name := "replica" + string(rune('a'+i)) + ".tsv"
+		content := strings.Replace(scannerTestTSV, "cold7_VentSK_status ", "cold7_Vent_"+string(rune('a'+i))+"_status", 1)
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, name), []byte(content), 0644))
+		names = append(names, name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// две реплики на одной папке input и одной БД
+	go service.NewScanner(cfg, repo, nil).Start(ctx)
+	go service.NewScanner(cfg, repo, nil).Start(ctx)
+
+	require.Eventually(t, func() bool {
+		for _, name := range names {
+			if repo.status(name) != models.StatusProcessed {
+				return false
+			}
+		}
+		return true
+	}, 3*time.Second, 50*time.Millisecond)
+
+	// дать второй реплике разобрать свою очередь
+	time.Sleep(200 * time.Millisecond)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, name := range names {
+		assert.Equal(t, 1, repo.ingests[name], "file %s must be ingested by exactly one replica", name)
+	}
+}
+
+func TestScannerJobQueue(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.Watch = false
+	cfg.Application.StabilityWindow = 0
+	repo := newMemoryRepo()
+
+	for _, name := range []string{"low.tsv", "high.tsv", "later.tsv"} {
+		content := strings.Replace(scannerTestTSV, "cold7_VentSK_status ", "cold7_Vent_"+name, 1)
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, name), []byte(content), 0644))
+	}
+
+	// задания, оставшиеся в очереди от прошлого запуска: загрузка через API важнее скана,
+	// а отложенное задание не берется раньше срока, даже если скан поставит файл еще раз
+	require.NoError(t, repo.EnqueueJob(context.Background(), "low.tsv", models.PriorityNormal, false))
+	require.NoError(t, repo.EnqueueJob(context.Background(), "high.tsv", models.PriorityHigh, false))
+	require.NoError(t, repo.EnqueueJob(context.Background(), "later.tsv", models.PriorityHigh, false))
+	repo.jobs["later.tsv"].NextRunAt = time.Now().Add(500 * time.Millisecond)
+	for _, name := range []string{"low.tsv", "high.tsv", "later.tsv"} {
+		repo.file(name).Status = models.StatusQueued
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.NewScanner(cfg, repo, nil).Start(ctx)
+
+	// выполненные задания удаляются из очереди
+	require.Eventually(t, func() bool {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		return len(repo.jobs) == 0
+	}, 3*time.Second, 50*time.Millisecond)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, []string{"high.tsv", "low.tsv", "later.tsv"}, repo.order)
+}
+
+func TestScannerRetryBackoff(t *testing.T) {
+	run := func(t *testing.T, failures int) (*memoryRepo, *config.Config, *service.Scanner) {
+		cfg := newScannerTestConfig(t)
+		cfg.Application.Watch = false
+		cfg.Application.Quarantine = t.TempDir()
+		cfg.Retry = config.RetryConfig{Base: 100 * time.Millisecond, Max: 200 * time.Millisecond, MaxAttempts: 3}
+		repo := newMemoryRepo()
+		repo.failures["flaky.tsv"] = failures
+
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "flaky.tsv"), []byte(scannerTestTSV), 0644))
+
+		scanner := service.NewScanner(cfg, repo, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go scanner.Start(ctx)
+
+		return repo, cfg, scanner
+	}
+
+	// после упавшей попытки файл ждет паузу в статусе error, а не держит воркера
+	t.Run("recovers", func(t *testing.T) {
+		repo, _, _ := run(t, 2)
+
+		require.Eventually(t, func() bool {
+			file := repo.processedFile("flaky.tsv")
+			return file.Status == models.StatusError && file.NextRetryAt != nil
+		}, time.Second, 10*time.Millisecond)
+
+		require.Eventually(t, func() bool {
+			return repo.status("flaky.tsv") == models.StatusProcessed
+		}, 3*time.Second, 50*time.Millisecond)
+
+		file := repo.processedFile("flaky.tsv")
+		assert.Equal(t, 3, file.Attempts)
+		assert.Nil(t, file.NextRetryAt)
+		assert.Equal(t, 2, repo.messageCount())
+	})
+
+	// исчерпавший попытки файл получает failed, уходит в карантин и больше не повторяется
+	t.Run("exhausted", func(t *testing.T) {
+		repo, cfg, scanner := run(t, 10)
+
+		require.Eventually(t, func() bool {
+			return repo.status("flaky.tsv") == models.StatusFailed
+		}, 3*time.Second, 50*time.Millisecond)
+
+		_, err := os.Stat(filepath.Join(cfg.Application.Quarantine, "flaky.tsv"))
+		require.NoError(t, err)
+
+		// тот же файл, снова подложенный в input, сам не загружается
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "flaky.tsv"), []byte(scannerTestTSV), 0644))
+		scanner.Scan(context.Background())
+		time.Sleep(500 * time.Millisecond)
+
+		file := repo.processedFile("flaky.tsv")
+		assert.Equal(t, models.StatusFailed, file.Status)
+		assert.Equal(t, models.ErrorTransient, file.ErrorCategory)
+		assert.Equal(t, 3, file.Attempts)
+		assert.Zero(t, repo.messageCount())
+	})
+}
+
+// остановка сервиса посреди файла не тратит его попытки: файл сразу возвращается в queued
+func TestScannerShutdownKeepsAttempts(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.Watch = false
+	repo := newMemoryRepo()
+	repo.ingesting = make(chan string)
+
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Application.Input, "slow.tsv"), []byte(scannerTestTSV), 0644))
+	// одна попытка уже упала раньше
+	repo.file("slow.tsv").Status = models.StatusError
+	repo.file("slow.tsv").Attempts = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.NewScanner(cfg, repo, nil).Start(ctx)
+
+	select {
+	case <-repo.ingesting:
+	case <-time.After(3 * time.Second):
+		t.Fatal("file was not picked up")
+	}
+	assert.Equal(t, 2, repo.processedFile("slow.tsv").Attempts)
+
+	cancel()
+
+	require.Eventually(t, func() bool {
+		return repo.status("slow.tsv") == models.StatusQueued
+	}, time.Second, 10*time.Millisecond)
+
+	file := repo.processedFile("slow.tsv")
+	assert.Equal(t, 1, file.Attempts)
+	assert.Empty(t, file.WorkerID)
+	assert.Nil(t, file.LeaseExpiresAt)
+
+	// задание вернулось в очередь
+	require.Eventually(t, func() bool {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		job := repo.jobs["slow.tsv"]
+		return job != nil && job.LockedBy == ""
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := config.RetryConfig{Base: time.Second, Max: 10 * time.Second}
+
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, 2*time.Second, policy.Delay(2))
+	assert.Equal(t, 8*time.Second, policy.Delay(4))
+	assert.Equal(t, 10*time.Second, policy.Delay(20), "delay is capped by max")
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		delay := policy.Delay(2)
+		assert.GreaterOrEqual(t, delay, 2*time.Second)
+		assert.LessOrEqual(t, delay, 3*time.Second)
+	}
+
+	assert.True(t, policy.Exhausted(1), "without max_attempts file is tried once")
+	policy.MaxAttempts = 3
+	assert.False(t, policy.Exhausted(2))
+	assert.True(t, policy.Exhausted(3))
+}
+
+// задание, которое падает еще до обработки файла, не крутится в очереди вечно
+func TestScannerJobAttemptsExhausted(t *testing.T) {
+	cfg := newScannerTestConfig(t)
+	cfg.Application.Watch = false
+	cfg.Application.PollInterval = 10 * time.Millisecond
+	cfg.Retry = config.RetryConfig{Base: 10 * time.Millisecond, Max: 20 * time.Millisecond, MaxAttempts: 3}
+	repo := newMemoryRepo()
+
+	// файл не читается: хеш не посчитать, до ClaimFile дело не доходит
+	require.NoError(t, os.Mkdir(filepath.Join(cfg.Application.Input, "broken.tsv"), 0755))
+	require.NoError(t, repo.EnqueueJob(context.Background(), "broken.tsv", models.PriorityNormal, false))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.NewScanner(cfg, repo, nil).Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return repo.status("broken.tsv") == models.StatusFailed
+	}, 3*time.Second, 20*time.Millisecond)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Empty(t, repo.jobs)
+	assert.Equal(t, models.ErrorTransient, repo.files["broken.tsv"].ErrorCategory)
+	assert.Contains(t, repo.files["broken.tsv"].ErrorMessage, "hash file")
+}
@@ -3,40 +3,54 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alonsoF100/reporting-service/internal/models"
 	"github.com/go-chi/chi/v5"
 )
 
+// unitGUIDPattern - unit_guid устройства всегда UUID, остальное отсекаем до запроса в БД
+var unitGUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 type Service interface {
-	GetDeviceMessages(ctx context.Context, unitGUID string, page, limit int) ([]models.DeviceMessage, int, error)
+	GetDeviceMessages(ctx context.Context, unitGUID string, filter models.MessageFilter, page, limit int) ([]models.DeviceMessage, int, error)
+	GetDeviceReport(ctx context.Context, unitGUID, format string, filter models.MessageFilter) (*models.Report, error)
 }
 
 type Handler struct {
-	Service Service
+	Service     Service
+	Files       FileService
+	UploadLimit int64 // максимальный размер загружаемого файла в байтах, 0 - без ограничения
 }
 
-func New(service Service) *Handler {
+func New(service Service, files FileService, uploadLimit int64) *Handler {
 	return &Handler{
-		Service: service,
+		Service:     service,
+		Files:       files,
+		UploadLimit: uploadLimit,
 	}
 }
 
 /*
 pattern: /api/v1/devices/{id}
 method: GET
-query: page, limit
-info: Get paginated messages for device by unit_guid
+query: page, limit, from, to, class, source_file
+info: Get paginated messages for device by unit_guid, each message carries its source_file and source_row. from/to filter on ingestion time (created_at of the first ingestion of the source file, kept across reprocess)
 
 succeed:
   - status code: 200 OK
   - response body: JSON with messages and pagination info
 
 failed:
-  - status code: 400 bad request - invalid parameters
+  - status code: 400 bad request - invalid parameters or unit_guid is not a UUID
   - status code: 404 not found - device not found
   - status code: 500 internal server error
   - response body: JSON with error message
@@ -47,6 +61,10 @@ func (h *Handler) GetDeviceMessages(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "unit_guid is required")
 		return
 	}
+	if !unitGUIDPattern.MatchString(unitGUID) {
+		respondWithError(w, http.StatusBadRequest, "unit_guid must be a UUID")
+		return
+	}
 
 	page := parseInt(r.URL.Query().Get("page"), 1)
 	limit := parseInt(r.URL.Query().Get("limit"), 50)
@@ -61,7 +79,13 @@ func (h *Handler) GetDeviceMessages(w http.ResponseWriter, r *http.Request) {
 		limit = 100
 	}
 
-	messages, total, err := h.Service.GetDeviceMessages(r.Context(), unitGUID, page, limit)
+	filter, err := parseMessageFilter(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	messages, total, err := h.Service.GetDeviceMessages(r.Context(), unitGUID, filter, page, limit)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -94,6 +118,121 @@ func (h *Handler) GetDeviceMessages(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, response)
 }
 
+/*
+pattern: /api/v1/devices/{id}/report
+method: GET
+query: format (pdf|html|csv|xlsx, default pdf), from, to (RFC3339 or YYYY-MM-DD), class (repeatable or comma separated), source_file
+info: Render device report on the fly from the database. from/to filter on ingestion time (created_at of the first ingestion of the source file, kept across reprocess)
+
+succeed:
+  - status code: 200 OK
+  - response body: report file with Content-Type and Content-Disposition
+
+failed:
+  - status code: 400 bad request - unknown format, invalid period or unit_guid is not a UUID
+  - status code: 404 not found - device not found or no messages for the filter
+  - status code: 500 internal server error
+  - response body: JSON with error message
+*/
+func (h *Handler) GetDeviceReport(w http.ResponseWriter, r *http.Request) {
+	unitGUID := chi.URLParam(r, "id")
+	if unitGUID == "" {
+		respondWithError(w, http.StatusBadRequest, "unit_guid is required")
+		return
+	}
+	if !unitGUIDPattern.MatchString(unitGUID) {
+		respondWithError(w, http.StatusBadRequest, "unit_guid must be a UUID")
+		return
+	}
+
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "pdf"
+	}
+
+	filter, err := parseMessageFilter(query)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rep, err := h.Service.GetDeviceReport(r.Context(), unitGUID, format, filter)
+	switch {
+	case errors.Is(err, models.ErrUnknownFormat):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, models.ErrNoMessages):
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", rep.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": rep.FileName}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(rep.Data)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rep.Data)
+}
+
+// parseMessageFilter - разбирает from/to/class/source_file из query
+func parseMessageFilter(query url.Values) (models.MessageFilter, error) {
+	filter := models.MessageFilter{
+		SourceFile: query.Get("source_file"),
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, _, err := parseTime(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from: %w", err)
+		}
+		filter.From = t
+	}
+
+	if to := query.Get("to"); to != "" {
+		t, dateOnly, err := parseTime(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to: %w", err)
+		}
+		// дата без времени включает весь день
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = t
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	for _, value := range query["class"] {
+		for _, class := range strings.Split(value, ",") {
+			if class = strings.TrimSpace(class); class != "" {
+				filter.Classes = append(filter.Classes, class)
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// parseTime - принимает RFC3339 или дату YYYY-MM-DD, второй результат - была ли это дата
+func parseTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected RFC3339 or YYYY-MM-DD, got %q", value)
+	}
+
+	return t, true, nil
+}
+
 func parseInt(value string, defaultValue int) int {
 	if value == "" {
 		return defaultValue
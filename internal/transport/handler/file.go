@@ -0,0 +1,371 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alonsoF100/reporting-service/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+type FileService interface {
+	UploadFile(ctx context.Context, fileName string, body io.Reader) (*models.ProcessedFile, error)
+	ListFiles(ctx context.Context, status string, page, limit int) ([]models.ProcessedFile, int, error)
+	GetFile(ctx context.Context, fileName string) (*models.FileDetails, error)
+	GetFileByID(ctx context.Context, id int64) (*models.FileDetails, error)
+	ReprocessFile(ctx context.Context, fileName string) (*models.ProcessedFile, error)
+	GetFileRejections(ctx context.Context, fileName string, page, limit int) ([]models.RejectedRow, int, int, error)
+}
+
+// errInvalidUpload - в запросе нет файла или его имени
+var errInvalidUpload = errors.New("invalid upload")
+
+// uploadTimeout - сколько можно принимать тело загрузки, общий read_timeout сервера для этого мал
+const uploadTimeout = 10 * time.Minute
+
+/*
+pattern: /api/v1/files
+method: POST
+query: name (file name for raw body)
+info: Upload an input file (multipart form field "file" or raw body with ?name=), it is stored in input,
+registered in processed_files with status queued and queued for processing right away
+
+succeed:
+  - status code: 202 accepted
+  - response body: JSON with the file record (id, name, status), Location header points to the file status
+    by id: /api/v1/files/id/{id}
+
+failed:
+  - status code: 400 bad request - no file or unsupported file type
+  - status code: 409 conflict - file with the same name is already waiting in input
+  - status code: 413 request entity too large - upload exceeds upload_max_size
+  - status code: 500 internal server error
+  - response body: JSON with error message
+*/
+func (h *Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(uploadTimeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(uploadTimeout))
+
+	if h.UploadLimit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.UploadLimit)
+	}
+
+	fileName, body, err := uploadBody(r)
+	if err != nil {
+		respondWithFileError(w, err)
+		return
+	}
+
+	file, err := h.Files.UploadFile(r.Context(), fileName, body)
+	if err != nil {
+		respondWithFileError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fileLocation(file.ID))
+	respondWithJSON(w, http.StatusAccepted, file)
+}
+
+// uploadBody - имя и содержимое файла из multipart формы (поле file) или из тела запроса с ?name=
+func uploadBody(r *http.Request) (string, io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		fileName := r.URL.Query().Get("name")
+		if fileName == "" {
+			return "", nil, fmt.Errorf("%w: name query parameter is required for raw upload", errInvalidUpload)
+		}
+		return fileName, r.Body, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %w", errInvalidUpload, err)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", nil, fmt.Errorf(`%w: multipart field "file" is required`, errInvalidUpload)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %w", errInvalidUpload, err)
+		}
+
+		if part.FormName() == "file" && part.FileName() != "" {
+			return part.FileName(), part, nil
+		}
+	}
+}
+
+// fileNameParam - имя файла из пути. Файл из zip называется <архив>/<путь внутри>, в URL
+// слеши в нем экранированы (%2F), и chi тогда матчит по сырому пути - параметр надо раскодировать
+func fileNameParam(r *http.Request) string {
+	fileName := chi.URLParam(r, "name")
+	if r.URL.RawPath == "" {
+		return fileName
+	}
+
+	// сырой путь net/http уже проверил при разборе запроса
+	if decoded, err := url.PathUnescape(fileName); err == nil {
+		fileName = decoded
+	}
+	return fileName
+}
+
+// fileLocation - путь к статусу файла по id для заголовка Location
+func fileLocation(id int64) string {
+	return "/api/v1/files/id/" + strconv.FormatInt(id, 10)
+}
+
+func respondWithFileError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds %d bytes", tooLarge.Limit))
+	case errors.Is(err, errInvalidUpload), errors.Is(err, models.ErrUnsupportedFile):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrUnknownStatus):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, models.ErrFileExists), errors.Is(err, models.ErrFileBusy):
+		respondWithError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, models.ErrFileGone):
+		respondWithError(w, http.StatusGone, err.Error())
+	case errors.Is(err, models.ErrFileNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	default:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+/*
+pattern: /api/v1/files
+method: GET
+query: status, page, limit
+info: Get paginated list of known input files with their processing status, newest first
+
+succeed:
+  - status code: 200 OK
+  - response body: JSON with files and pagination info
+
+failed:
+  - status code: 400 bad request - unknown status
+  - status code: 500 internal server error
+  - response body: JSON with error message
+*/
+func (h *Handler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+
+	page := parseInt(r.URL.Query().Get("page"), 1)
+	limit := parseInt(r.URL.Query().Get("limit"), 50)
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	files, total, err := h.Files.ListFiles(r.Context(), status, page, limit)
+	if err != nil {
+		respondWithFileError(w, err)
+		return
+	}
+
+	if files == nil {
+		files = []models.ProcessedFile{}
+	}
+
+	response := struct {
+		Status string                 `json:"status,omitempty"`
+		Total  int                    `json:"total"`
+		Page   int                    `json:"page"`
+		Limit  int                    `json:"limit"`
+		Pages  int                    `json:"pages"`
+		Files  []models.ProcessedFile `json:"files"`
+	}{
+		Status: status,
+		Total:  total,
+		Page:   page,
+		Limit:  limit,
+		Pages:  (total + limit - 1) / limit,
+		Files:  files,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+/*
+pattern: /api/v1/files/{name}
+method: GET
+info: Get processing status of the input file, e.g. to poll an upload, with number of attempts,
+last error, number of loaded messages and rejected rows and the devices the file touched.
+A file extracted from zip is named <zip>/<entry>, in the path the slash is escaped: bundle.zip%2Fa.tsv
+
+succeed:
+  - status code: 200 OK
+  - response body: JSON with file id, status, attempts, error message, revision, messages, devices, rejected
+
+failed:
+  - status code: 404 not found - file is not known
+  - status code: 500 internal server error
+  - response body: JSON with error message
+*/
+func (h *Handler) GetFile(w http.ResponseWriter, r *http.Request) {
+	fileName := fileNameParam(r)
+
+	file, err := h.Files.GetFile(r.Context(), fileName)
+	if err != nil {
+		respondWithFileError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, file)
+}
+
+/*
+pattern: /api/v1/files/id/{id}
+method: GET
+info: Get processing status of the input file by the id returned on upload and reprocess,
+same as /api/v1/files/{name}. The id does not change when the file is reprocessed
+
+succeed:
+  - status code: 200 OK
+  - response body: JSON with file id, status, attempts, error message, revision, messages, devices, rejected
+
+failed:
+  - status code: 400 bad request - id is not a positive integer
+  - status code: 404 not found - file is not known
+  - status code: 500 internal server error
+  - response body: JSON with error message
+*/
+func (h *Handler) GetFileByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id < 1 {
+		respondWithError(w, http.StatusBadRequest, "file id must be a positive integer")
+		return
+	}
+
+	file, err := h.Files.GetFileByID(r.Context(), id)
+	if err != nil {
+		respondWithFileError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, file)
+}
+
+/*
+pattern: /api/v1/files/{name}/reprocess
+method: POST
+info: Force re-ingest of the file even if it was processed or is a duplicate: the file is brought back
+to input from quarantine or archive if needed, its status is reset to queued and it is queued right away.
+For a file extracted from zip the whole archive is reprocessed
+
+succeed:
+  - status code: 202 accepted
+  - response body: JSON with the file record (id, name, status), Location header points to the file status
+    by id: /api/v1/files/id/{id}
+
+failed:
+  - status code: 404 not found - file is not known
+  - status code: 409 conflict - file is already queued or being processed
+  - status code: 410 gone - file is no longer in input, archive or quarantine
+  - status code: 500 internal server error
+  - response body: JSON with error message
+*/
+func (h *Handler) ReprocessFile(w http.ResponseWriter, r *http.Request) {
+	fileName := fileNameParam(r)
+
+	file, err := h.Files.ReprocessFile(r.Context(), fileName)
+	if err != nil {
+		respondWithFileError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fileLocation(file.ID))
+	respondWithJSON(w, http.StatusAccepted, file)
+}
+
+/*
+pattern: /api/v1/files/{name}/rejections
+method: GET
+query: page, limit
+info: Get rows of the file that failed validation on ingest, with line numbers and reasons
+
+succeed:
+  - status code: 200 OK
+  - response body: JSON with rejected rows and pagination info (empty list if nothing was rejected);
+    only the first rejected rows are stored, rejected_total and truncated tell if the list is incomplete
+
+failed:
+  - status code: 400 bad request - invalid parameters
+  - status code: 404 not found - file is not known
+  - status code: 500 internal server error
+  - response body: JSON with error message
+*/
+func (h *Handler) GetFileRejections(w http.ResponseWriter, r *http.Request) {
+	fileName := fileNameParam(r)
+	if fileName == "" {
+		respondWithError(w, http.StatusBadRequest, "file name is required")
+		return
+	}
+
+	page := parseInt(r.URL.Query().Get("page"), 1)
+	limit := parseInt(r.URL.Query().Get("limit"), 50)
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	rejected, stored, total, err := h.Files.GetFileRejections(r.Context(), fileName, page, limit)
+	if err != nil {
+		respondWithFileError(w, err)
+		return
+	}
+
+	if rejected == nil {
+		rejected = []models.RejectedRow{}
+	}
+
+	// сохраняются только первые отклоненные строки: total - сколько их в списке,
+	// rejected_total - сколько отклонено всего, truncated - список неполный
+	response := struct {
+		FileName      string               `json:"file_name"`
+		Total         int                  `json:"total"`
+		RejectedTotal int                  `json:"rejected_total"`
+		Truncated     bool                 `json:"truncated"`
+		Page          int                  `json:"page"`
+		Limit         int                  `json:"limit"`
+		Pages         int                  `json:"pages"`
+		Rejected      []models.RejectedRow `json:"rejected"`
+	}{
+		FileName:      fileName,
+		Total:         stored,
+		RejectedTotal: total,
+		Truncated:     total > stored,
+		Page:          page,
+		Limit:         limit,
+		Pages:         (stored + limit - 1) / limit,
+		Rejected:      rejected,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
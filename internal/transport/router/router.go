@@ -20,6 +20,13 @@ func (rt Router) Setup() *chi.Mux {
 
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Get("/devices/{id}", rt.Handler.GetDeviceMessages)
+		r.Get("/devices/{id}/report", rt.Handler.GetDeviceReport)
+		r.Get("/files", rt.Handler.ListFiles)
+		r.Post("/files", rt.Handler.UploadFile)
+		r.Get("/files/{name}", rt.Handler.GetFile)
+		r.Get("/files/id/{id}", rt.Handler.GetFileByID)
+		r.Post("/files/{name}/reprocess", rt.Handler.ReprocessFile)
+		r.Get("/files/{name}/rejections", rt.Handler.GetFileRejections)
 	})
 
 	return r
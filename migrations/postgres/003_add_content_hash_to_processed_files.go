@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upProcessedFilesContentHash, downProcessedFilesContentHash)
+}
+
+func upProcessedFilesContentHash(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files
+			ADD COLUMN content_hash CHAR(64),
+			ADD COLUMN revision INTEGER NOT NULL DEFAULT 1,
+			ADD COLUMN duplicate_of VARCHAR(255);
+
+		CREATE INDEX idx_processed_files_content_hash ON processed_files(content_hash);
+	`)
+	return err
+}
+
+func downProcessedFilesContentHash(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files
+			DROP COLUMN content_hash,
+			DROP COLUMN revision,
+			DROP COLUMN duplicate_of;
+	`)
+	return err
+}
@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upDeviceMessagesSourceRow, downDeviceMessagesSourceRow)
+}
+
+func upDeviceMessagesSourceRow(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE device_messages ADD COLUMN source_row INTEGER;
+	`)
+	return err
+}
+
+func downDeviceMessagesSourceRow(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `ALTER TABLE device_messages DROP COLUMN source_row;`)
+	return err
+}
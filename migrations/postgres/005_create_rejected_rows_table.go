@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upRejectedRows, downRejectedRows)
+}
+
+func upRejectedRows(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE rejected_rows (
+			id BIGSERIAL PRIMARY KEY,
+			file_name VARCHAR(255) NOT NULL,
+			row_number INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			content TEXT,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX idx_rejected_rows_file_name ON rejected_rows(file_name, row_number);
+	`)
+	return err
+}
+
+func downRejectedRows(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `DROP TABLE rejected_rows;`)
+	return err
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upProcessedFilesArchivePath, downProcessedFilesArchivePath)
+}
+
+// файлы из zip называются <архив>/<путь внутри>, и с вложенными папками имя легко длиннее 255 символов,
+// поэтому все колонки с именами файлов - TEXT
+func upProcessedFilesArchivePath(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files
+			ADD COLUMN archive_path TEXT,
+			ALTER COLUMN file_name TYPE TEXT,
+			ALTER COLUMN duplicate_of TYPE TEXT;
+
+		ALTER TABLE device_messages ALTER COLUMN source_file TYPE TEXT;
+		ALTER TABLE rejected_rows ALTER COLUMN file_name TYPE TEXT;
+
+		CREATE INDEX idx_processed_files_archive_path ON processed_files(archive_path);
+	`)
+	return err
+}
+
+func downProcessedFilesArchivePath(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE rejected_rows ALTER COLUMN file_name TYPE VARCHAR(255);
+		ALTER TABLE device_messages ALTER COLUMN source_file TYPE VARCHAR(255);
+
+		ALTER TABLE processed_files
+			DROP COLUMN archive_path,
+			ALTER COLUMN file_name TYPE VARCHAR(255),
+			ALTER COLUMN duplicate_of TYPE VARCHAR(255);
+	`)
+	return err
+}
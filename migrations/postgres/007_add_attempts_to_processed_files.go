@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upProcessedFilesAttempts, downProcessedFilesAttempts)
+}
+
+func upProcessedFilesAttempts(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `ALTER TABLE processed_files ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;`)
+	return err
+}
+
+func downProcessedFilesAttempts(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `ALTER TABLE processed_files DROP COLUMN attempts;`)
+	return err
+}
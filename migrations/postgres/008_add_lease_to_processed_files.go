@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upProcessedFilesLease, downProcessedFilesLease)
+}
+
+func upProcessedFilesLease(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files
+			ADD COLUMN worker_id VARCHAR(255),
+			ADD COLUMN heartbeat_at TIMESTAMP WITH TIME ZONE,
+			ADD COLUMN lease_expires_at TIMESTAMP WITH TIME ZONE;
+
+		CREATE INDEX idx_processed_files_lease ON processed_files(status, lease_expires_at);
+	`)
+	return err
+}
+
+func downProcessedFilesLease(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		DROP INDEX IF EXISTS idx_processed_files_lease;
+
+		ALTER TABLE processed_files
+			DROP COLUMN worker_id,
+			DROP COLUMN heartbeat_at,
+			DROP COLUMN lease_expires_at;
+	`)
+	return err
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upJobs, downJobs)
+}
+
+func upJobs(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE jobs (
+			id BIGSERIAL PRIMARY KEY,
+			file_name VARCHAR(255) NOT NULL UNIQUE,
+			priority INTEGER NOT NULL DEFAULT 0,
+			force BOOLEAN NOT NULL DEFAULT FALSE,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			locked_by VARCHAR(255),
+			locked_until TIMESTAMP WITH TIME ZONE,
+			last_error TEXT,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX idx_jobs_ready ON jobs(priority DESC, next_run_at, id);
+	`)
+	return err
+}
+
+func downJobs(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `DROP TABLE jobs;`)
+	return err
+}
@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upProcessedFilesNextRetry, downProcessedFilesNextRetry)
+}
+
+func upProcessedFilesNextRetry(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files ADD COLUMN next_retry_at TIMESTAMP WITH TIME ZONE;
+	`)
+	return err
+}
+
+func downProcessedFilesNextRetry(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files DROP COLUMN next_retry_at;
+	`)
+	return err
+}
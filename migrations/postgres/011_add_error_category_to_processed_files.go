@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upProcessedFilesErrorCategory, downProcessedFilesErrorCategory)
+}
+
+func upProcessedFilesErrorCategory(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files ADD COLUMN error_category VARCHAR(20);
+	`)
+	return err
+}
+
+func downProcessedFilesErrorCategory(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files DROP COLUMN error_category;
+	`)
+	return err
+}
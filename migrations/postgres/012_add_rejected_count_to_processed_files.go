@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upProcessedFilesRejectedCount, downProcessedFilesRejectedCount)
+}
+
+// в rejected_rows хранятся только первые отклоненные строки файла, полное число - здесь
+func upProcessedFilesRejectedCount(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files ADD COLUMN rejected_count INTEGER NOT NULL DEFAULT 0;
+
+		UPDATE processed_files f
+		SET rejected_count = r.cnt
+		FROM (SELECT file_name, COUNT(*) AS cnt FROM rejected_rows GROUP BY file_name) r
+		WHERE r.file_name = f.file_name;
+	`)
+	return err
+}
+
+func downProcessedFilesRejectedCount(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE processed_files DROP COLUMN rejected_count;
+	`)
+	return err
+}
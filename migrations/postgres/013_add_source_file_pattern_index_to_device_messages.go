@@ -0,0 +1,32 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upDeviceMessagesSourceFilePattern, downDeviceMessagesSourceFilePattern)
+}
+
+// сообщения всех файлов zip ищутся по префиксу source_file (LIKE 'архив/%'), обычный индекс
+// при не-C collation для LIKE не годится. text_pattern_ops покрывает и поиск по равенству
+func upDeviceMessagesSourceFilePattern(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		DROP INDEX idx_device_messages_source_file;
+
+		CREATE INDEX idx_device_messages_source_file ON device_messages(source_file text_pattern_ops);
+	`)
+	return err
+}
+
+func downDeviceMessagesSourceFilePattern(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		DROP INDEX idx_device_messages_source_file;
+
+		CREATE INDEX idx_device_messages_source_file ON device_messages(source_file);
+	`)
+	return err
+}